@@ -0,0 +1,122 @@
+package ledcontroller
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// WriteStats counts the attribute writes a backend issued, skipped because the value was unchanged,
+// and that failed
+type WriteStats struct {
+	Issued  int
+	Skipped int
+	Failed  int
+}
+
+// WriteCounter is implemented by backends that count their writes
+type WriteCounter interface {
+	WriteStats() *WriteStats
+	ResetWriteStats()
+}
+
+// writeCounters are the write counters shared by the attribute files of a backend
+type writeCounters struct {
+	issued  atomic.Int64
+	skipped atomic.Int64
+	failed  atomic.Int64
+}
+
+// snapshot returns the current counts
+func (wc *writeCounters) snapshot() *WriteStats {
+	return &WriteStats{
+		Issued:  int(wc.issued.Load()),
+		Skipped: int(wc.skipped.Load()),
+		Failed:  int(wc.failed.Load()),
+	}
+}
+
+// reset sets every count back to zero
+func (wc *writeCounters) reset() {
+	wc.issued.Store(0)
+	wc.skipped.Store(0)
+	wc.failed.Store(0)
+}
+
+// attrFile is a sysfs attribute kept open between writes.
+// A write of the value last written is skipped, unless the kernel may have changed it since.
+type attrFile struct {
+	path     string
+	counters *writeCounters
+
+	mu   sync.Mutex
+	file *os.File
+	// 文件在sysfs上，写入即替换整个值，不需要截断
+	sysfs bool
+	// 最近写入的值，known为false时文件内容未知
+	value string
+	known bool
+}
+
+// newAttrFile creates an attribute file, opened on the first write
+func newAttrFile(path string, counters *writeCounters) *attrFile {
+	return &attrFile{path: path, counters: counters}
+}
+
+// write writes value at the start of the file, skipping the write if the file already holds it
+func (f *attrFile) write(value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.known && f.value == value {
+		f.counters.skipped.Add(1)
+		return nil
+	}
+
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			f.counters.failed.Add(1)
+			return err
+		}
+		f.file = file
+		f.sysfs = onSysfs(file)
+	}
+
+	if _, err := f.file.WriteAt([]byte(value), 0); err != nil {
+		f.counters.failed.Add(1)
+		// 设备可能已经消失，下次写入时重新打开
+		f.file.Close()
+		f.file = nil
+		f.known = false
+		return err
+	}
+	// sysfs属性不支持截断，普通文件（测试用的假目录树）需要截掉旧内容的剩余部分
+	if !f.sysfs && (!f.known || len(value) < len(f.value)) {
+		f.file.Truncate(int64(len(value)))
+	}
+	f.counters.issued.Add(1)
+	f.value = value
+	f.known = true
+	return nil
+}
+
+// invalidate forgets the last written value, used when a kernel trigger takes over the attribute
+func (f *attrFile) invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.known = false
+}
+
+// close releases the file descriptor, the next write opens it again
+func (f *attrFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.known = false
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package ledcontroller
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysfsMagic is the file system type of sysfs, SYSFS_MAGIC in linux/magic.h
+const sysfsMagic = 0x62656572
+
+// onSysfs reports whether an open file lives on sysfs
+func onSysfs(file *os.File) bool {
+	var fs syscall.Statfs_t
+	if err := syscall.Fstatfs(int(file.Fd()), &fs); err != nil {
+		return false
+	}
+	return fs.Type == sysfsMagic
+}
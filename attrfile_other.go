@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ledcontroller
+
+import "os"
+
+// onSysfs reports whether an open file lives on sysfs, which only exists on Linux
+func onSysfs(file *os.File) bool {
+	return false
+}
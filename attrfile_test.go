@@ -0,0 +1,62 @@
+package ledcontroller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttrFileWriteStats(t *testing.T) {
+	root := t.TempDir()
+	dirs := fakeRGB(t, root, nil)
+	writeTestAttr(t, dirs[CHANNEL_RED], "brightness", "255")
+	b := NewSysfsBackend(dirs[0]+"/brightness", dirs[1]+"/brightness", dirs[2]+"/brightness")
+
+	for _, value := range []int{200, 200, 7, 7, 7, 30} {
+		if err := b.WriteChannel(CHANNEL_RED, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := b.WriteStats(); *stats != (WriteStats{Issued: 3, Skipped: 3}) {
+		t.Errorf("WriteStats = %+v, want 3 issued and 3 skipped", *stats)
+	}
+	// 假目录树中较短的值截掉了旧内容
+	if raw := readTestAttr(t, dirs[CHANNEL_RED], "brightness"); raw != "30" {
+		t.Errorf("brightness = %q, want 30", raw)
+	}
+
+	// 关闭后设备消失，重新打开失败
+	b.Close()
+	os.RemoveAll(dirs[CHANNEL_RED])
+	if err := b.WriteChannel(CHANNEL_RED, 30); err == nil {
+		t.Fatal("write to a removed LED succeeded")
+	}
+	if stats := b.WriteStats(); *stats != (WriteStats{Issued: 3, Skipped: 3, Failed: 1}) {
+		t.Errorf("WriteStats after a failure = %+v, want 3 issued, 3 skipped and 1 failed", *stats)
+	}
+
+	b.ResetWriteStats()
+	if stats := b.WriteStats(); *stats != (WriteStats{}) {
+		t.Errorf("WriteStats after reset = %+v, want zero", *stats)
+	}
+}
+
+func TestOnSysfs(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "brightness"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if onSysfs(file) {
+		t.Error("onSysfs reported a temporary file as sysfs")
+	}
+
+	sysfsFile, err := os.Open("/sys/kernel/uevent_seqnum")
+	if err != nil {
+		t.Skip("sysfs is not mounted")
+	}
+	defer sysfsFile.Close()
+	if !onSysfs(sysfsFile) {
+		t.Error("onSysfs did not recognize a sysfs attribute")
+	}
+}
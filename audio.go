@@ -0,0 +1,223 @@
+package ledcontroller
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Audio analysis tuning
+const (
+	// 低音/中音和中音/高音的分频点
+	audioBassCutoff   = 200.0
+	audioTrebleCutoff = 2000.0
+
+	// 电平上升和回落的时间常数
+	audioAttack  = 20 * time.Millisecond
+	audioRelease = 200 * time.Millisecond
+	// 计算平均能量的时间常数，用于自动增益
+	audioAverageWindow = 2 * time.Second
+
+	// 低音能量超过平均值的倍数视为节拍起点
+	audioOnsetThreshold = 1.6
+	// 两个节拍起点之间的最短间隔
+	audioOnsetHoldoff = 120 * time.Millisecond
+	// 节拍闪光的衰减时间常数
+	audioFlashDecay = 150 * time.Millisecond
+	// 超过这个时间没有新数据时开始熄灭
+	audioStaleAfter = 200 * time.Millisecond
+)
+
+// audioAnalyzer turns PCM samples or band levels into a color:
+// bass drives red, mid green and treble blue, and detected onsets flash white
+type audioAnalyzer struct {
+	mu    sync.Mutex
+	clock Clock
+
+	// 分频滤波器状态
+	sampleRate int
+	lowBass    float64
+	lowTreble  float64
+
+	// 平滑后的各频段电平0-1，平均能量和上一块的低音能量
+	levels   [3]float64
+	average  [3]float64
+	lastBass float64
+
+	flash     float64
+	sinceBeat time.Duration
+	updated   time.Time
+}
+
+// newAudioAnalyzer creates an analyzer with silent state
+func newAudioAnalyzer(clock Clock) *audioAnalyzer {
+	return &audioAnalyzer{clock: clock, sinceBeat: audioOnsetHoldoff}
+}
+
+// pushPCM16 analyzes a block of interleaved little-endian 16 bit samples
+func (a *audioAnalyzer) pushPCM16(data []byte, sampleRate, channels int) error {
+	if sampleRate <= 0 || channels <= 0 {
+		return fmt.Errorf("无效的采样率或声道数: %d, %d", sampleRate, channels)
+	}
+	frameSize := 2 * channels
+	if len(data)%frameSize != 0 {
+		return fmt.Errorf("PCM数据长度%d不是帧大小%d的整数倍", len(data), frameSize)
+	}
+	frames := len(data) / frameSize
+	if frames == 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if sampleRate != a.sampleRate {
+		a.sampleRate = sampleRate
+		a.lowBass, a.lowTreble = 0, 0
+	}
+	bassCoeff := 1 - math.Exp(-2*math.Pi*audioBassCutoff/float64(sampleRate))
+	trebleCoeff := 1 - math.Exp(-2*math.Pi*audioTrebleCutoff/float64(sampleRate))
+
+	// 两个一阶低通滤波器把信号分成低、中、高三个频段，累加各频段能量
+	var energy [3]float64
+	for i := 0; i < frames; i++ {
+		sum := 0.0
+		for ch := 0; ch < channels; ch++ {
+			offset := i*frameSize + 2*ch
+			sum += float64(int16(binary.LittleEndian.Uint16(data[offset:])))
+		}
+		x := sum / float64(channels) / 32768
+
+		a.lowBass += bassCoeff * (x - a.lowBass)
+		a.lowTreble += trebleCoeff * (x - a.lowTreble)
+		bands := [3]float64{a.lowBass, a.lowTreble - a.lowBass, x - a.lowTreble}
+		for band, value := range bands {
+			energy[band] += value * value
+		}
+	}
+	for band := range energy {
+		energy[band] = math.Sqrt(energy[band] / float64(frames))
+	}
+
+	dt := time.Duration(frames) * time.Second / time.Duration(sampleRate)
+	a.update(a.normalize(energy, dt), energy[CHANNEL_RED], dt)
+	return nil
+}
+
+// pushLevels applies band levels computed by the caller, each in [0, 1]
+func (a *audioAnalyzer) pushLevels(bass, mid, treble float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// 按两次调用之间的实际间隔平滑，间隔异常时按一帧处理
+	dt := a.clock.Now().Sub(a.updated)
+	if a.updated.IsZero() || dt > audioStaleAfter {
+		dt = frameInterval
+	}
+
+	levels := [3]float64{clamp01(bass), clamp01(mid), clamp01(treble)}
+	a.average[CHANNEL_RED] += (levels[CHANNEL_RED] - a.average[CHANNEL_RED]) * smoothing(dt, audioAverageWindow)
+	a.update(levels, levels[CHANNEL_RED], dt)
+}
+
+// normalize scales band energies against their running average, so the average maps to half brightness.
+// mutex must be held.
+func (a *audioAnalyzer) normalize(energy [3]float64, dt time.Duration) [3]float64 {
+	var levels [3]float64
+	for band, value := range energy {
+		// 第一块数据直接作为平均值，避免开始时电平饱和
+		if a.average[band] == 0 {
+			a.average[band] = value
+		}
+		a.average[band] += (value - a.average[band]) * smoothing(dt, audioAverageWindow)
+		if a.average[band] > 1e-4 {
+			levels[band] = clamp01(value / (2 * a.average[band]))
+		}
+	}
+	return levels
+}
+
+// update smooths new levels and runs onset detection on the bass energy, mutex must be held
+func (a *audioAnalyzer) update(levels [3]float64, bass float64, dt time.Duration) {
+	for band, level := range levels {
+		constant := audioRelease
+		if level > a.levels[band] {
+			constant = audioAttack
+		}
+		a.levels[band] += (level - a.levels[band]) * smoothing(dt, constant)
+	}
+
+	// 低音能量突然超过平均值时视为节拍起点，触发一次闪光
+	a.flash *= 1 - smoothing(dt, audioFlashDecay)
+	a.sinceBeat += dt
+	average := a.average[CHANNEL_RED]
+	if a.sinceBeat >= audioOnsetHoldoff && average > 1e-4 &&
+		bass > average*audioOnsetThreshold && bass > a.lastBass {
+		a.flash = 1
+		a.sinceBeat = 0
+	}
+	a.lastBass = bass
+	a.updated = a.clock.Now()
+}
+
+// color returns the current color, fading out when no data has arrived recently
+func (a *audioAnalyzer) color() Color {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fade := 1.0
+	if stale := a.clock.Now().Sub(a.updated) - audioStaleAfter; stale > 0 {
+		fade = 1 - smoothing(stale, audioRelease)
+	}
+
+	var values [3]int
+	for band, level := range a.levels {
+		// 节拍闪光把三个通道一起提亮
+		level = math.Max(level, 0.8*a.flash)
+		values[band] = int(255 * level * fade)
+	}
+	return Color{values[0], values[1], values[2]}
+}
+
+// Frame renders the live analysis, it never ends on its own
+func (a *audioAnalyzer) Frame(t time.Duration) (Color, time.Duration, bool) {
+	return a.color(), 0, false
+}
+
+// smoothing returns the one-pole filter coefficient for a step of dt with the given time constant
+func smoothing(dt, constant time.Duration) float64 {
+	if constant <= 0 {
+		return 1
+	}
+	return 1 - math.Exp(-float64(dt)/float64(constant))
+}
+
+// clamp01 limits a value to [0, 1]
+func clamp01(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
+
+// PushPCM16 feeds interleaved little-endian 16 bit PCM to the audio-reactive effect
+func (c *Controller) PushPCM16(data []byte, sampleRate, channels int) error {
+	return c.audio.pushPCM16(data, sampleRate, channels)
+}
+
+// PushLevels feeds bass, mid and treble levels in [0, 1] to the audio-reactive effect,
+// for hosts that already run their own analysis such as the Android Visualizer
+func (c *Controller) PushLevels(bass, mid, treble float64) {
+	c.audio.pushLevels(bass, mid, treble)
+}
+
+// MusicReactiveEffect drives the LED live from pushed audio:
+// bass to red, mid to green, treble to blue, with a white flash on each beat, until stopped
+func (c *Controller) MusicReactiveEffect() error {
+	return c.runBuiltinEffect(EFFECT_MUSIC_REACTIVE)
+}
+
+// musicReactiveEffect renders MusicReactiveEffect until stopped
+func (c *Controller) musicReactiveEffect(ctx context.Context) error {
+	return c.playPattern(ctx, c.audio)
+}
@@ -0,0 +1,248 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Channel indexes
+const (
+	CHANNEL_RED   = 0
+	CHANNEL_GREEN = 1
+	CHANNEL_BLUE  = 2
+)
+
+// Capabilities describes what an LED backend supports
+type Capabilities struct {
+	// 可写入的通道数
+	Channels int
+	// 硬件的最大亮度值（写入值统一为0-255，由后端负责换算）
+	MaxBrightness int
+	// 是否支持读取当前通道值
+	Readable bool
+	// 是否能一次写入完整颜色（实现了ColorWriter）
+	AtomicColor bool
+}
+
+// Backend is the output layer every effect writes through.
+// Values are always in the 0-255 range, the backend maps them to the hardware.
+type Backend interface {
+	WriteChannel(channel int, value int) error
+	ReadChannel(channel int) (int, error)
+	Capabilities() *Capabilities
+}
+
+// sysfsChannel is one LED class device used as a color channel
+type sysfsChannel struct {
+	// LED设备目录
+	dir string
+	// brightness文件路径
+	path string
+	// 保持打开的brightness文件
+	brightness *attrFile
+	// 设备的max_brightness，用于把0-255换算到硬件范围
+	maxBrightness int
+	// 设备支持的内核触发器
+	triggers map[string]bool
+}
+
+// SysfsBackend drives three single-color LEDs through their sysfs brightness files
+type SysfsBackend struct {
+	channels [3]sysfsChannel
+	counters writeCounters
+}
+
+// NewSysfsBackend creates a backend writing the given brightness files.
+// The max_brightness file next to each brightness file is used for scaling when present.
+// The brightness files stay open until Close, and unchanged values are not written again.
+func NewSysfsBackend(redPath, greenPath, bluePath string) *SysfsBackend {
+	b := &SysfsBackend{}
+	for channel, path := range []string{redPath, greenPath, bluePath} {
+		dir := filepath.Dir(path)
+		b.channels[channel] = sysfsChannel{
+			dir:           dir,
+			path:          path,
+			brightness:    newAttrFile(path, &b.counters),
+			maxBrightness: readMaxBrightness(dir),
+			triggers:      readTriggers(dir),
+		}
+	}
+	return b
+}
+
+// channel returns the sysfs channel for a channel index
+func (b *SysfsBackend) channel(channel int) (*sysfsChannel, error) {
+	if channel < CHANNEL_RED || channel > CHANNEL_BLUE {
+		return nil, fmt.Errorf("无效的通道: %d", channel)
+	}
+	return &b.channels[channel], nil
+}
+
+// WriteChannel writes a 0-255 value scaled to the channel's max_brightness
+func (b *SysfsBackend) WriteChannel(channel int, value int) error {
+	ch, err := b.channel(channel)
+	if err != nil {
+		return err
+	}
+	raw := scaleToDevice(value, ch.maxBrightness)
+	return ch.brightness.write(strconv.Itoa(raw))
+}
+
+// ReadChannel reads the current channel value, scaled back to 0-255
+func (b *SysfsBackend) ReadChannel(channel int) (int, error) {
+	ch, err := b.channel(channel)
+	if err != nil {
+		return 0, err
+	}
+	raw, err := readIntFile(ch.path)
+	if err != nil {
+		return 0, err
+	}
+	return scaleFromDevice(raw, ch.maxBrightness), nil
+}
+
+// Capabilities reports the sysfs backend capabilities
+func (b *SysfsBackend) Capabilities() *Capabilities {
+	// 以最小的通道范围为准
+	maxBrightness := b.channels[CHANNEL_RED].maxBrightness
+	for _, ch := range b.channels {
+		if ch.maxBrightness < maxBrightness {
+			maxBrightness = ch.maxBrightness
+		}
+	}
+	return &Capabilities{
+		Channels:      3,
+		MaxBrightness: maxBrightness,
+		Readable:      true,
+	}
+}
+
+// WriteStats returns the brightness writes issued and skipped so far
+func (b *SysfsBackend) WriteStats() *WriteStats {
+	return b.counters.snapshot()
+}
+
+// ResetWriteStats sets the write counters back to zero
+func (b *SysfsBackend) ResetWriteStats() {
+	b.counters.reset()
+}
+
+// Close releases the open brightness files, later writes reopen them
+func (b *SysfsBackend) Close() error {
+	var firstErr error
+	for _, ch := range b.channels {
+		if err := ch.brightness.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// scaleToDevice maps a 0-255 value to the 0-max device range
+func scaleToDevice(value, max int) int {
+	if max == 255 {
+		return value
+	}
+	raw := (value*max + 127) / 255
+	// 非零值至少写1，避免max_brightness很小的设备在低亮度时直接熄灭
+	if raw == 0 && value > 0 {
+		raw = 1
+	}
+	return raw
+}
+
+// scaleFromDevice maps a 0-max device value back to 0-255
+func scaleFromDevice(raw, max int) int {
+	if max == 255 || max <= 0 {
+		return raw
+	}
+	value := (raw*255 + max/2) / max
+	if value > 255 {
+		value = 255
+	}
+	return value
+}
+
+// readIntFile reads a sysfs attribute holding a single integer
+func readIntFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// readMaxBrightness reads max_brightness from an LED device directory, defaulting to 255
+func readMaxBrightness(dir string) int {
+	max, err := readIntFile(filepath.Join(dir, "max_brightness"))
+	if err != nil || max <= 0 {
+		return 255
+	}
+	return max
+}
+
+// SetBackend replaces the backend used by all effects and setters
+func (c *Controller) SetBackend(b Backend) {
+	if b == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.backend = b
+}
+
+// GetBackend returns the backend currently in use
+func (c *Controller) GetBackend() Backend {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.backend
+}
+
+// BackendName returns a short name for the type of a backend, such as "sysfs" or "sim"
+func BackendName(b Backend) string {
+	switch b.(type) {
+	case *SysfsBackend:
+		return "sysfs"
+	case *MulticolorBackend:
+		return "multicolor"
+	case *SimBackend:
+		return "sim"
+	case *TerminalBackend:
+		return "terminal"
+	}
+	return fmt.Sprintf("%T", b)
+}
+
+// GetWriteStats returns the backend's write counters, all zero if the backend does not count writes
+func (c *Controller) GetWriteStats() *WriteStats {
+	if wc, ok := c.GetBackend().(WriteCounter); ok {
+		return wc.WriteStats()
+	}
+	return &WriteStats{}
+}
+
+// ResetWriteStats sets the backend's write counters back to zero
+func (c *Controller) ResetWriteStats() {
+	if wc, ok := c.GetBackend().(WriteCounter); ok {
+		wc.ResetWriteStats()
+	}
+}
+
+// Close stops all effects, switches the LED off, stops the render goroutine and releases the files
+// the backend keeps open. The controller stays usable, later writes reopen the files and the next
+// pattern starts the goroutine again.
+func (c *Controller) Close() error {
+	if err := c.TurnOffLED(); err != nil {
+		log.Printf("Close: 关闭LED失败: %v", err)
+	}
+	c.renderer.close()
+	if closer, ok := c.GetBackend().(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
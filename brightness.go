@@ -0,0 +1,191 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Night mode defaults
+const (
+	DEFAULT_NIGHT_BRIGHTNESS = 20
+	MINUTES_PER_DAY          = 24 * 60
+)
+
+// warmTone is the hue night mode shifts colors to
+var warmTone = Color{255, 110, 20}
+
+// SetBrightness sets the master brightness in percent, applied live to every write
+func (c *Controller) SetBrightness(percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("亮度必须在0-100范围内")
+	}
+	c.mutex.Lock()
+	c.brightness = percent
+	c.outputVersion++
+	c.mutex.Unlock()
+	c.reapplyColor()
+	return nil
+}
+
+// GetBrightness returns the master brightness in percent
+func (c *Controller) GetBrightness() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.brightness
+}
+
+// SetNightMode switches night mode on or off manually, independent of the schedule
+func (c *Controller) SetNightMode(enabled bool) {
+	c.mutex.Lock()
+	c.nightMode = enabled
+	c.outputVersion++
+	c.mutex.Unlock()
+	c.reapplyColor()
+}
+
+// IsNightModeEnabled returns whether night mode was switched on manually
+func (c *Controller) IsNightModeEnabled() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.nightMode
+}
+
+// IsNightModeActive returns whether night mode currently applies, manually or by schedule
+func (c *Controller) IsNightModeActive() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.nightActive(c.clock.Now())
+}
+
+// SetNightModeOptions sets the brightness cap in percent and whether colors turn warm in night mode
+func (c *Controller) SetNightModeOptions(maxBrightness int, warm bool) error {
+	if maxBrightness < 0 || maxBrightness > 100 {
+		return fmt.Errorf("夜间模式亮度必须在0-100范围内")
+	}
+	c.mutex.Lock()
+	c.nightBrightness = maxBrightness
+	c.nightWarm = warm
+	c.outputVersion++
+	c.mutex.Unlock()
+	c.reapplyColor()
+	return nil
+}
+
+// SetNightSchedule turns night mode on every day between two local times,
+// in minutes since midnight. The window may span midnight, e.g. 22:00-07:00 is 1320, 420.
+func (c *Controller) SetNightSchedule(startMinute, endMinute int) error {
+	if startMinute < 0 || startMinute >= MINUTES_PER_DAY || endMinute < 0 || endMinute >= MINUTES_PER_DAY {
+		return fmt.Errorf("时间必须在0-%d分钟范围内", MINUTES_PER_DAY-1)
+	}
+	if startMinute == endMinute {
+		return fmt.Errorf("开始和结束时间不能相同")
+	}
+	c.mutex.Lock()
+	c.nightStart = startMinute
+	c.nightEnd = endMinute
+	c.outputVersion++
+	c.scheduleNightBoundary()
+	c.mutex.Unlock()
+	c.reapplyColor()
+	return nil
+}
+
+// ClearNightSchedule removes the night mode schedule
+func (c *Controller) ClearNightSchedule() {
+	c.mutex.Lock()
+	c.nightStart, c.nightEnd = -1, -1
+	c.outputVersion++
+	c.scheduleNightBoundary()
+	c.mutex.Unlock()
+	c.reapplyColor()
+}
+
+// nightActive reports whether night mode applies at a time, mutex must be held
+func (c *Controller) nightActive(now time.Time) bool {
+	if c.nightMode {
+		return true
+	}
+	return c.nightStart >= 0 && inMinuteWindow(minuteOfDay(now), c.nightStart, c.nightEnd)
+}
+
+// scheduleNightBoundary arms a timer for the next schedule start or end, mutex must be held.
+// Static colors are rewritten at the boundary, effects pick up the change on their next frame.
+func (c *Controller) scheduleNightBoundary() {
+	if c.nightTimer != nil {
+		c.nightTimer.Stop()
+		c.nightTimer = nil
+	}
+	if c.nightStart < 0 {
+		return
+	}
+
+	now := c.clock.Now()
+	next := nextMinuteOfDay(now, c.nightStart)
+	if end := nextMinuteOfDay(now, c.nightEnd); end.Before(next) {
+		next = end
+	}
+	c.nightTimer = c.clock.AfterFunc(next.Sub(now), func() {
+		log.Println("scheduleNightBoundary: 夜间模式时间段切换")
+		c.mutex.Lock()
+		c.outputVersion++
+		c.scheduleNightBoundary()
+		c.mutex.Unlock()
+		c.reapplyColor()
+	})
+}
+
+// adjustColor applies night mode, do-not-disturb dimming and the master brightness to a color,
+// mutex must be held
+func (c *Controller) adjustColor(color Color, now time.Time) Color {
+	scale := float64(c.brightness) / 100
+	// 勿扰模式降低当前效果的亮度
+	if c.effectDimmed {
+		scale *= float64(c.dndDimLevel) / 100
+	}
+	if c.nightActive(now) {
+		scale = math.Min(scale, float64(c.nightBrightness)/100)
+		if c.nightWarm {
+			// 保留亮度，颜色换成暖色调
+			level := float64(max(color.Red, color.Green, color.Blue)) / 255
+			color = scaleColor(warmTone, level)
+		}
+	}
+	if scale >= 1 {
+		return color
+	}
+	return scaleColor(color, scale)
+}
+
+// scaleColor multiplies every channel by factor
+func scaleColor(color Color, factor float64) Color {
+	return Color{
+		int(math.Round(float64(color.Red) * factor)),
+		int(math.Round(float64(color.Green) * factor)),
+		int(math.Round(float64(color.Blue) * factor)),
+	}
+}
+
+// minuteOfDay returns the minutes since local midnight
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+// inMinuteWindow reports whether a minute of the day falls in [start, end), wrapping past midnight
+func inMinuteWindow(minute, start, end int) bool {
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// nextMinuteOfDay returns the next time after now at the given minute of the day
+func nextMinuteOfDay(now time.Time, minute int) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(time.Duration(minute) * time.Minute)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,105 @@
+package ledcontroller
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// gammaCalibration applies the same gamma to every channel
+func gammaCalibration(gamma float64) *Calibration {
+	return &Calibration{
+		Red:   &ChannelCalibration{Gamma: gamma},
+		Green: &ChannelCalibration{Gamma: gamma},
+		Blue:  &ChannelCalibration{Gamma: gamma},
+	}
+}
+
+// startPulse runs a one-second red pulse forever and waits until it waits on the clock
+func startPulse(t *testing.T, c *Controller, clock *FakeClock) context.CancelFunc {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.PulseColor(ctx, ColorRed, 0, time.Second)
+		close(done)
+	}()
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("PulseColor did not wait on the clock")
+	}
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// rendering reports whether the renderer of a controller is playing a pattern
+func rendering(c *Controller) bool {
+	c.renderer.mu.Lock()
+	defer c.renderer.mu.Unlock()
+	return c.renderer.job != nil
+}
+
+// readBrightness reads a brightness attribute as a number
+func readBrightness(t *testing.T, dir string) int {
+	t.Helper()
+	value, err := strconv.Atoi(readTestAttr(t, dir, "brightness"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestCalibratedPulseRunsInSoftware(t *testing.T) {
+	root := t.TempDir()
+	dirs := fakeRGB(t, root, triggerAttrs("255"))
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{
+		Discovery:   &DiscoveryConfig{Root: root},
+		Clock:       clock,
+		Calibration: gammaCalibration(2.2),
+	})
+
+	stop := startPulse(t, c, clock)
+	defer stop()
+	red := dirs[CHANNEL_RED]
+	if trigger := readTestAttr(t, red, "trigger"); trigger == TRIGGER_PATTERN {
+		t.Fatal("calibrated pulse was offloaded to the pattern trigger")
+	}
+
+	// 渐亮到一半时线性值约为128，经过2.2的伽马后约为56
+	clock.Advance(250 * time.Millisecond)
+	if brightness := readBrightness(t, red); brightness < 45 || brightness > 65 {
+		t.Errorf("brightness halfway up = %d, want the gamma-shaped value of about 56", brightness)
+	}
+}
+
+func TestCalibrationStopsPulseOffload(t *testing.T) {
+	root := t.TempDir()
+	dirs := fakeRGB(t, root, triggerAttrs("255"))
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Discovery: &DiscoveryConfig{Root: root}, Clock: clock})
+
+	stop := startPulse(t, c, clock)
+	defer stop()
+	red := dirs[CHANNEL_RED]
+	if trigger := readTestAttr(t, red, "trigger"); trigger != TRIGGER_PATTERN {
+		t.Fatalf("uncalibrated pulse trigger = %q, want pattern", trigger)
+	}
+
+	// 下一次检查时发现校准，清除触发器后改为软件渲染
+	if err := c.SetCalibration(gammaCalibration(2.2)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(offloadCheckInterval)
+	// 检查计时器先于清除触发器重新设置，Advance返回时效果可能还在切换，
+	// 等到软件渲染设置了下一帧的计时器再继续
+	waitFor(t, "the software pulse", func() bool {
+		return readTestAttr(t, red, "trigger") == TRIGGER_NONE && rendering(c) && clock.PendingTimers() > 0
+	})
+	clock.Advance(250 * time.Millisecond)
+	if brightness := readBrightness(t, red); brightness < 45 || brightness > 65 {
+		t.Errorf("brightness halfway up = %d, want the gamma-shaped value of about 56", brightness)
+	}
+}
@@ -0,0 +1,128 @@
+// Package client controls the LEDs through the lightd daemon instead of a controller of its own
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+
+	"light/daemon"
+)
+
+// DefaultTimeout is how long a call waits for the daemon to answer
+const DefaultTimeout = 5 * time.Second
+
+// Client is a connection to the daemon, safe for concurrent use
+type Client struct {
+	rpc *rpc.Client
+
+	mu      sync.Mutex
+	timeout time.Duration
+}
+
+// Dial connects to the daemon listening at path, daemon.DefaultSocketPath if path is empty
+func Dial(path string) (*Client, error) {
+	if path == "" {
+		path = daemon.DefaultSocketPath
+	}
+	conn, err := net.DialTimeout("unix", path, DefaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("连接守护进程失败: %v", err)
+	}
+	return &Client{rpc: jsonrpc.NewClient(conn), timeout: DefaultTimeout}, nil
+}
+
+// SetTimeout sets how long each call waits for the answer, 0 waits forever.
+// Calls already waiting keep the timeout they started with.
+// A call that times out closes the connection, later calls fail until the client is dialed again.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = timeout
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+// call invokes a daemon method and waits for the answer up to the timeout.
+// On timeout it closes the connection instead of leaving the call pending on it,
+// the daemon may still carry the call out.
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+	c.mu.Lock()
+	timeout := c.timeout
+	c.mu.Unlock()
+
+	call := c.rpc.Go(daemon.ServiceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	if timeout <= 0 {
+		<-call.Done
+		return call.Error
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		// 关闭连接后rpc会以ErrShutdown结束挂起的调用
+		c.rpc.Close()
+		return fmt.Errorf("调用%s超时，连接已关闭", method)
+	}
+}
+
+// StartEffect requests an effect type and returns the arbitration decision, one of DECISION_*
+func (c *Client) StartEffect(effectType int) (int, error) {
+	reply := &daemon.StartEffectReply{}
+	if err := c.call("StartEffect", &daemon.StartEffectArgs{Effect: effectType}, reply); err != nil {
+		return 0, err
+	}
+	return reply.Decision, nil
+}
+
+// StartEffectByName requests an effect by name, such as "wifi-connecting", and returns the effect type
+// and the arbitration decision
+func (c *Client) StartEffectByName(name string) (int, int, error) {
+	reply := &daemon.StartEffectReply{}
+	if err := c.call("StartEffect", &daemon.StartEffectArgs{Name: name}, reply); err != nil {
+		return 0, 0, err
+	}
+	return reply.Effect, reply.Decision, nil
+}
+
+// StopCurrentEffect stops the running effect and returns once the LED is off
+func (c *Client) StopCurrentEffect() error {
+	return c.call("StopCurrentEffect", &daemon.Empty{}, &daemon.Empty{})
+}
+
+// SetRGB stops all effects and shows a static color with 0-255 channels
+func (c *Client) SetRGB(red, green, blue int) error {
+	return c.call("SetRGB", &daemon.SetRGBArgs{Red: red, Green: green, Blue: blue}, &daemon.Empty{})
+}
+
+// SetLEDEnabled switches the LED master switch
+func (c *Client) SetLEDEnabled(enabled bool) error {
+	return c.call("SetLEDEnabled", &daemon.SetLEDEnabledArgs{Enabled: enabled}, &daemon.Empty{})
+}
+
+// GetCurrentEffect returns the running effect type, EFFECT_NONE when idle
+func (c *Client) GetCurrentEffect() (int, error) {
+	reply := &daemon.EffectReply{}
+	if err := c.call("GetCurrentEffect", &daemon.Empty{}, reply); err != nil {
+		return 0, err
+	}
+	return reply.Effect, nil
+}
+
+// Status returns a snapshot of the daemon's controller
+func (c *Client) Status() (*daemon.Status, error) {
+	reply := &daemon.Status{}
+	if err := c.call("Status", &daemon.Empty{}, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	ledcontroller "light"
+	"light/daemon"
+)
+
+// startDaemon serves a controller on a simulated backend and returns its socket path
+func startDaemon(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lightd")
+	l, err := daemon.Listen(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := daemon.NewServer(ledcontroller.NewController(&ledcontroller.ControllerOptions{Backend: ledcontroller.NewSimBackend()}))
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	return path
+}
+
+func TestSetTimeoutWhileCalling(t *testing.T) {
+	c, err := Dial(startDaemon(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.SetTimeout(time.Duration(i+1) * time.Second)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if err := c.SetRGB(i, 0, 0); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	status, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Color != "#630000" {
+		t.Errorf("color = %s, want #630000", status.Color)
+	}
+}
+
+func TestEndToEnd(t *testing.T) {
+	c, err := Dial(startDaemon(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	effect, decision, err := c.StartEffectByName("wifi-connecting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if effect != ledcontroller.EFFECT_WIFI_CONNECTING || decision != ledcontroller.DECISION_STARTED {
+		t.Errorf("wifi-connecting = effect %d decision %d, want %d %d",
+			effect, decision, ledcontroller.EFFECT_WIFI_CONNECTING, ledcontroller.DECISION_STARTED)
+	}
+	if effect, err := c.GetCurrentEffect(); err != nil || effect != ledcontroller.EFFECT_WIFI_CONNECTING {
+		t.Errorf("current effect = %d (%v), want %d", effect, err, ledcontroller.EFFECT_WIFI_CONNECTING)
+	}
+
+	// 每种仲裁结果都原样传回客户端
+	for _, tc := range []struct {
+		effect   int
+		decision int
+	}{
+		{ledcontroller.EFFECT_CHARGING_HIGH, ledcontroller.DECISION_QUEUED},
+		{ledcontroller.EFFECT_CALL, ledcontroller.DECISION_PREEMPTED},
+		{ledcontroller.EFFECT_WIFI_FAILED, ledcontroller.DECISION_REJECTED},
+	} {
+		if decision, err := c.StartEffect(tc.effect); err != nil || decision != tc.decision {
+			t.Errorf("StartEffect(%d) = %d (%v), want %d", tc.effect, decision, err, tc.decision)
+		}
+	}
+	if effect, err := c.GetCurrentEffect(); err != nil || effect != ledcontroller.EFFECT_CALL {
+		t.Errorf("current effect = %d (%v), want %d", effect, err, ledcontroller.EFFECT_CALL)
+	}
+	if _, err := c.StartEffect(999); err == nil {
+		t.Error("StartEffect accepted an unknown effect type")
+	}
+	if _, _, err := c.StartEffectByName("no-such-effect"); err == nil {
+		t.Error("StartEffectByName accepted an unknown name")
+	}
+
+	if err := c.StopCurrentEffect(); err != nil {
+		t.Fatal(err)
+	}
+	if effect, err := c.GetCurrentEffect(); err != nil || effect == ledcontroller.EFFECT_CALL {
+		t.Errorf("current effect after StopCurrentEffect = %d (%v)", effect, err)
+	}
+
+	if err := c.SetLEDEnabled(false); err != nil {
+		t.Fatal(err)
+	}
+	if decision, err := c.StartEffect(ledcontroller.EFFECT_CALL); err != nil || decision != ledcontroller.DECISION_DISABLED {
+		t.Errorf("StartEffect while disabled = %d (%v), want %d", decision, err, ledcontroller.DECISION_DISABLED)
+	}
+
+	status, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Enabled {
+		t.Error("status reports the LED enabled")
+	}
+	if status.Color != "#000000" {
+		t.Errorf("color = %s, want #000000", status.Color)
+	}
+	if status.Backend != "sim" {
+		t.Errorf("backend = %s, want sim", status.Backend)
+	}
+	if status.Clients != 1 {
+		t.Errorf("clients = %d, want 1", status.Clients)
+	}
+}
+
+func TestTimeoutClosesConnection(t *testing.T) {
+	// 接受连接但从不应答的守护进程
+	path := filepath.Join(t.TempDir(), "lightd")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetTimeout(50 * time.Millisecond)
+	if _, err := c.GetCurrentEffect(); err == nil {
+		t.Fatal("call to an unresponsive daemon succeeded")
+	}
+
+	// 超时后连接已关闭，之后的调用立即失败
+	c.SetTimeout(0)
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.GetCurrentEffect()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("call after a timeout succeeded")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call after a timeout is still waiting")
+	}
+}
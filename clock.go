@@ -0,0 +1,260 @@
+package ledcontroller
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of a controller and every effect it runs.
+// Tests replace the system clock with a FakeClock to run long effects instantly.
+type Clock interface {
+	Now() time.Time
+	// NewTimer creates a timer that sends the time on its channel after d
+	NewTimer(d time.Duration) Timer
+	// AfterFunc calls f in its own goroutine after d
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single-shot timer created by a Clock
+type Timer interface {
+	// C returns the channel the time is sent on, nil for AfterFunc timers
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// SystemClock returns the clock backed by the time package
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// systemClock is the real clock
+type systemClock struct{}
+
+// Now returns the current time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer creates a time.Timer
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{time.NewTimer(d)}
+}
+
+// AfterFunc creates a time.Timer calling f
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &systemTimer{time.AfterFunc(d, f)}
+}
+
+// systemTimer adapts time.Timer to Timer
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time        { return t.t.C }
+func (t *systemTimer) Stop() bool                 { return t.t.Stop() }
+func (t *systemTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// sleepContext waits for d on the clock, returning false if ctx is cancelled first
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C():
+		return true
+	}
+}
+
+// fakeSettleTimeout is how long Advance waits in real time for woken goroutines
+// to arm their next timer before moving on
+const fakeSettleTimeout = 20 * time.Millisecond
+
+// FakeClock is a manually advanced clock for tests.
+// Advance moves time forward timer by timer: each due timer fires at its own time, and
+// Advance waits for the woken goroutine to arm its next timer before firing the next one,
+// so effects observe the exact times they asked for.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	// 每次有计时器被设置时通知Advance
+	armed chan struct{}
+}
+
+// NewFakeClock creates a fake clock starting at start, a zero start selects a fixed date
+func NewFakeClock(start time.Time) *FakeClock {
+	if start.IsZero() {
+		start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	}
+	return &FakeClock{now: start, armed: make(chan struct{}, 1)}
+}
+
+// Now returns the fake time
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTimer creates a timer firing when the fake time reaches now+d
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc calls fn in its own goroutine when the fake time reaches now+d
+func (f *FakeClock) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{clock: f, f: fn}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the fake time forward by d, firing every timer that comes due on the way
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	target := f.now.Add(d)
+	f.mu.Unlock()
+
+	for {
+		f.mu.Lock()
+		if len(f.timers) == 0 || f.timers[0].when.After(target) {
+			f.now = target
+			f.mu.Unlock()
+			return
+		}
+		t := f.timers[0]
+		f.timers = f.timers[1:]
+		f.now = t.when
+		// 清除之前的通知，只等待这次触发之后设置的计时器
+		select {
+		case <-f.armed:
+		default:
+		}
+		t.fire(f.now)
+		f.mu.Unlock()
+
+		f.settle()
+	}
+}
+
+// settle waits until a timer is armed or the settle timeout passes
+func (f *FakeClock) settle() {
+	timer := time.NewTimer(fakeSettleTimeout)
+	defer timer.Stop()
+	select {
+	case <-f.armed:
+	case <-timer.C:
+	}
+}
+
+// PendingTimers returns the number of timers waiting to fire
+func (f *FakeClock) PendingTimers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+// WaitForTimers waits in real time until at least n timers are pending, so a test can be sure
+// the goroutines it started are waiting on the clock before advancing it
+func (f *FakeClock) WaitForTimers(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for f.PendingTimers() < n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+// schedule inserts a timer in firing order, mu must be held
+func (f *FakeClock) schedule(t *fakeTimer) {
+	i := sort.Search(len(f.timers), func(i int) bool { return f.timers[i].when.After(t.when) })
+	f.timers = append(f.timers, nil)
+	copy(f.timers[i+1:], f.timers[i:])
+	f.timers[i] = t
+}
+
+// unschedule removes a timer, reporting whether it was pending. mu must be held.
+func (f *FakeClock) unschedule(t *fakeTimer) bool {
+	for i, pending := range f.timers {
+		if pending == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer is a timer of a FakeClock
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	c     chan time.Time
+	f     func()
+}
+
+// C returns the timer channel
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop cancels the timer, reporting whether it was pending
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.drain()
+	return t.clock.unschedule(t)
+}
+
+// Reset reschedules the timer to fire after d, reporting whether it was pending
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	f := t.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t.drain()
+	pending := f.unschedule(t)
+	t.when = f.now.Add(d)
+	if d <= 0 {
+		t.fire(f.now)
+	} else {
+		f.schedule(t)
+	}
+	select {
+	case f.armed <- struct{}{}:
+	default:
+	}
+	return pending
+}
+
+// fire delivers the timer, clock mutex must be held
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+// drain discards an undelivered tick, like time.Timer does on Stop and Reset since Go 1.23
+func (t *fakeTimer) drain() {
+	if t.c == nil {
+		return
+	}
+	select {
+	case <-t.c:
+	default:
+	}
+}
@@ -0,0 +1,100 @@
+package ledcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// simWrite is a recorded write relative to the start of a test
+type simWrite struct {
+	at      time.Duration
+	channel int
+	value   int
+}
+
+// simWritesSince returns the recorded writes with their time relative to start
+func simWritesSince(sim *SimBackend, start time.Time) []simWrite {
+	var writes []simWrite
+	for _, w := range sim.Writes() {
+		writes = append(writes, simWrite{w.Time.Sub(start), w.Channel, w.Value})
+	}
+	return writes
+}
+
+// rgbWrites are the three channel writes of a color at a time
+func rgbWrites(at time.Duration, color Color) []simWrite {
+	return []simWrite{
+		{at, CHANNEL_RED, color.Red},
+		{at, CHANNEL_GREEN, color.Green},
+		{at, CHANNEL_BLUE, color.Blue},
+	}
+}
+
+// checkSimWrites compares recorded writes with the expected ones
+func checkSimWrites(t *testing.T, got []simWrite, want ...[]simWrite) {
+	t.Helper()
+	var all []simWrite
+	for _, w := range want {
+		all = append(all, w...)
+	}
+	if len(got) != len(all) {
+		t.Fatalf("recorded %d writes %v, want %d %v", len(got), got, len(all), all)
+	}
+	for i := range all {
+		if got[i] != all[i] {
+			t.Errorf("write %d = %+v, want %+v", i, got[i], all[i])
+		}
+	}
+}
+
+func TestSimBlinkTimeline(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	sim.SetClock(clock)
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	start := clock.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.BlinkColor(context.Background(), ColorRed, 2, 100*time.Millisecond, 50*time.Millisecond)
+	}()
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("BlinkColor did not wait on the clock")
+	}
+	clock.Advance(400 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	checkSimWrites(t, simWritesSince(sim, start),
+		rgbWrites(0, ColorRed),
+		rgbWrites(100*time.Millisecond, ColorOff),
+		rgbWrites(150*time.Millisecond, ColorRed),
+		rgbWrites(250*time.Millisecond, ColorOff))
+}
+
+func TestSimBuiltinEffectTimeline(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	sim.SetClock(clock)
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	start := clock.Now()
+
+	// 蓝牙已连接：蓝色保持3秒后关闭
+	if err := c.BluetoothConnectedEffect(); err != nil {
+		t.Fatal(err)
+	}
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("the effect did not wait on the clock")
+	}
+	clock.Advance(3 * time.Second)
+	waitFor(t, "the effect to finish", func() bool { return !c.IsEffectActive() })
+
+	got := simWritesSince(sim, start)
+	if len(got) < 6 {
+		t.Fatalf("recorded writes %v, want blue then off", got)
+	}
+	checkSimWrites(t, got[:3], rgbWrites(0, ColorBlue))
+	checkSimWrites(t, got[len(got)-3:], rgbWrites(3*time.Second, ColorOff))
+}
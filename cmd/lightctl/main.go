@@ -0,0 +1,480 @@
+// Command lightctl drives the LEDs from a shell, for example over adb.
+//
+// Usage:
+//
+//	lightctl [--backend sysfs|sim|terminal] [--sysfs-root dir] [--socket path] [-v] <command> [arguments]
+//
+// Commands:
+//
+//	set <color>                  show a color: #rrggbb, #rgb, r,g,b, a CSS name or a temperature such as 2700K
+//	off                          switch the LED off
+//	run <effect> [--duration d]  run a built-in effect until it ends, d has passed or the command is interrupted
+//	play <file> [--duration d]   play a JSON effect file the same way
+//	list                         list the built-in effects
+//	status                       show the backend and the color currently shown
+//	enable, disable              switch the LED master switch on or off
+//
+// Without --socket each invocation drives the LEDs with its own controller, so the master switch
+// and the running effect only last as long as the command. A color set on the sysfs backend stays
+// after it exits.
+//
+// With --socket the commands go to the lightd daemon listening there (/dev/socket/lightd on the
+// device) and change its state: enable and disable stay in effect, and an effect started by run
+// keeps running after the command exits unless --duration is given. play needs a local controller.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	ledcontroller "light"
+	"light/client"
+	"light/daemon"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is a lightctl subcommand
+type command struct {
+	// 位置参数的说明，为空表示没有参数
+	args string
+	help string
+	// 是否接受--duration
+	timed bool
+	// 只能使用本地控制器，不能通过守护进程运行
+	local bool
+	run   func(env *env, args []string) error
+}
+
+// env is what a command runs with, either a local controller or a daemon client
+type env struct {
+	ctx      context.Context
+	c        *ledcontroller.Controller
+	client   *client.Client
+	duration time.Duration
+	stdout   io.Writer
+}
+
+// commands are the subcommands by name
+var commands = map[string]*command{
+	"set":     {args: "<color>", help: "show a color: #rrggbb, #rgb, r,g,b, a CSS name or a temperature such as 2700K", run: runSet},
+	"off":     {help: "switch the LED off", run: runOff},
+	"run":     {args: "<effect>", help: "run a built-in effect until it ends, --duration has passed or it is interrupted", timed: true, run: runEffect},
+	"play":    {args: "<file>", help: "play a JSON effect file until it ends, --duration has passed or it is interrupted", timed: true, local: true, run: runPlay},
+	"list":    {help: "list the built-in effects", run: runList},
+	"status":  {help: "show the backend and the color currently shown", run: runStatus},
+	"enable":  {help: "switch the LED master switch on", run: runEnable},
+	"disable": {help: "switch the LED master switch off, which also switches the LED off", run: runDisable},
+}
+
+func main() {
+	os.Exit(lightctl(os.Args[1:]))
+}
+
+// lightctl runs the command line and returns the exit code
+func lightctl(args []string) int {
+	flags := flag.NewFlagSet("lightctl", flag.ContinueOnError)
+	flags.Usage = func() { usage(flags.Output(), flags) }
+	backendName := flags.String("backend", "sysfs", "LED backend: sysfs, sim or terminal")
+	sysfsRoot := flags.String("sysfs-root", "", "sysfs mount point the sysfs backend discovers LEDs under (default /sys)")
+	socketPath := flags.String("socket", "", "send the command to the lightd daemon listening at this path, e.g. "+daemon.DefaultSocketPath)
+	verbose := flags.Bool("v", false, "print the controller log")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		usage(os.Stderr, flags)
+		return exitUsage
+	}
+
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "lightctl: 未知的命令: %s\n", name)
+		usage(os.Stderr, flags)
+		return exitUsage
+	}
+
+	cmdFlags := flag.NewFlagSet("lightctl "+name, flag.ContinueOnError)
+	cmdFlags.Usage = func() {
+		fmt.Fprintf(cmdFlags.Output(), "Usage: lightctl %s %s\n\n%s\n", name, cmd.usageArgs(), cmd.help)
+		cmdFlags.PrintDefaults()
+	}
+	duration := time.Duration(0)
+	if cmd.timed {
+		cmdFlags.DurationVar(&duration, "duration", 0, "stop after this long, 0 waits until the effect ends")
+	}
+	positional, err := parseInterspersed(cmdFlags, flags.Args()[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if want := len(strings.Fields(cmd.args)); len(positional) != want {
+		fmt.Fprintf(os.Stderr, "lightctl: %s 需要%d个参数\n", name, want)
+		cmdFlags.Usage()
+		return exitUsage
+	}
+	if duration < 0 {
+		fmt.Fprintln(os.Stderr, "lightctl: --duration不能为负数")
+		return exitUsage
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	e := &env{
+		ctx:      ctx,
+		duration: duration,
+		stdout:   os.Stdout,
+	}
+	if *socketPath != "" {
+		if cmd.local {
+			fmt.Fprintf(os.Stderr, "lightctl: %s 不能通过守护进程运行\n", name)
+			return exitUsage
+		}
+		cl, err := client.Dial(*socketPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lightctl: %v\n", err)
+			return exitError
+		}
+		defer cl.Close()
+		e.client = cl
+		if err := cmd.run(e, positional); err != nil {
+			fmt.Fprintf(os.Stderr, "lightctl: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	options := &ledcontroller.ControllerOptions{}
+	switch *backendName {
+	case "sysfs":
+		// 后端为空时由控制器自动发现
+		if *sysfsRoot != "" {
+			options.Discovery = &ledcontroller.DiscoveryConfig{Root: *sysfsRoot}
+		}
+	case "sim":
+		options.Backend = ledcontroller.NewSimBackend()
+	case "terminal":
+		options.Backend = ledcontroller.NewTerminalBackend(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "lightctl: 未知的后端: %s\n", *backendName)
+		return exitUsage
+	}
+
+	e.c = ledcontroller.NewController(options)
+	err = cmd.run(e, positional)
+	if _, ok := options.Backend.(*ledcontroller.TerminalBackend); ok {
+		// 结束色块所在的行
+		fmt.Fprintln(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lightctl: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// usageArgs returns the argument synopsis of a command
+func (cmd *command) usageArgs() string {
+	if cmd.timed {
+		return strings.TrimSpace(cmd.args + " [--duration d]")
+	}
+	return cmd.args
+}
+
+// usage prints the command line synopsis, the commands and the global flags
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: lightctl [flags] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(tw, "  %s %s\t%s\n", name, cmd.usageArgs(), cmd.help)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// parseInterspersed parses flags that may appear before, between or after the positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseColor parses a color accepted by ParseColor, or three comma separated 0-255 values
+func parseColor(value string) (*ledcontroller.Color, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return ledcontroller.ParseColor(value)
+	}
+	var values [3]int
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < 0 || v > 255 {
+			return nil, fmt.Errorf("颜色值必须是0-255的整数: %q", part)
+		}
+		values[i] = v
+	}
+	return &ledcontroller.Color{Red: values[0], Green: values[1], Blue: values[2]}, nil
+}
+
+// runSet shows a static color
+func runSet(e *env, args []string) error {
+	color, err := parseColor(args[0])
+	if err != nil {
+		return err
+	}
+	if e.client != nil {
+		return e.client.SetRGB(color.Red, color.Green, color.Blue)
+	}
+	return e.c.SetRGB(color.Red, color.Green, color.Blue)
+}
+
+// runOff switches the LED off
+func runOff(e *env, args []string) error {
+	if e.client != nil {
+		// 守护进程的SetRGB先停止全部效果
+		return e.client.SetRGB(0, 0, 0)
+	}
+	return e.c.TurnOffLED()
+}
+
+// runEnable switches the master switch on
+func runEnable(e *env, args []string) error {
+	return e.setLEDEnabled(true)
+}
+
+// runDisable switches the master switch off
+func runDisable(e *env, args []string) error {
+	return e.setLEDEnabled(false)
+}
+
+// setLEDEnabled switches the master switch, which only outlasts the command through the daemon
+func (e *env) setLEDEnabled(enabled bool) error {
+	if e.client != nil {
+		return e.client.SetLEDEnabled(enabled)
+	}
+	e.c.SetLEDEnabled(enabled)
+	return nil
+}
+
+// runEffect runs a built-in effect
+func runEffect(e *env, args []string) error {
+	effectType := ledcontroller.EffectTypeByName(args[0])
+	if !ledcontroller.IsBuiltinEffect(effectType) {
+		return fmt.Errorf("未知的效果: %s，可用的效果见 lightctl list", args[0])
+	}
+	if e.client != nil {
+		return e.runRemote(effectType)
+	}
+	return e.wait(effectType, func() error {
+		return decisionError(e.c.RequestEffect(effectType), effectType)
+	})
+}
+
+// runPlay plays an effect file
+func runPlay(e *env, args []string) error {
+	return e.wait(ledcontroller.EFFECT_CUSTOM, func() error {
+		return e.c.PlayEffectFile(args[0])
+	})
+}
+
+// runList prints the built-in effects
+func runList(e *env, args []string) error {
+	tw := tabwriter.NewWriter(e.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tRUNS")
+	for effectType := ledcontroller.EFFECT_BOOTUP; effectType <= ledcontroller.EFFECT_MUSIC_REACTIVE; effectType++ {
+		if !ledcontroller.IsBuiltinEffect(effectType) {
+			continue
+		}
+		runs := "once"
+		if ledcontroller.IsPersistentEffect(effectType) {
+			runs = "until stopped"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", ledcontroller.EffectName(effectType), effectType, runs)
+	}
+	return tw.Flush()
+}
+
+// runStatus prints the backend, the color shown and the controller state
+func runStatus(e *env, args []string) error {
+	if e.client != nil {
+		return e.remoteStatus()
+	}
+	b := e.c.GetBackend()
+	caps := b.Capabilities()
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "backend:\t%s (%d channels, max brightness %d)\n", ledcontroller.BackendName(b), caps.Channels, caps.MaxBrightness)
+	if color, err := e.c.GetCurrentColor(); err != nil {
+		fmt.Fprintf(tw, "color:\tunknown (%v)\n", err)
+	} else {
+		fmt.Fprintf(tw, "color:\t%s\n", color.Hex())
+	}
+	fmt.Fprintf(tw, "effect:\t%s\n", ledcontroller.EffectName(e.c.GetCurrentEffect()))
+	fmt.Fprintf(tw, "enabled:\t%t\n", e.c.IsLEDEnabled())
+	fmt.Fprintf(tw, "brightness:\t%d%%\n", e.c.GetBrightness())
+	return tw.Flush()
+}
+
+// decisionError describes a RequestEffect decision that did not start the effect right away.
+// Unlike DecisionError a queued effect is an error, since it is not running yet.
+func decisionError(decision, effectType int) error {
+	if decision == ledcontroller.DECISION_QUEUED {
+		return fmt.Errorf("效果已排队，等待当前效果结束")
+	}
+	return ledcontroller.DecisionError(decision, effectType)
+}
+
+// finishWaiter is the effect listener reporting when an effect ends
+type finishWaiter struct {
+	effectType int
+	// 效果结束时发送结束原因
+	finished chan int
+	// 效果出错时的错误信息，在发送结束原因之前设置
+	message string
+}
+
+func (w *finishWaiter) OnEffectStarted(effectType int) {}
+
+func (w *finishWaiter) OnEffectFinished(effectType int, reason int) {
+	if effectType != w.effectType {
+		return
+	}
+	select {
+	case w.finished <- reason:
+	default:
+	}
+}
+
+func (w *finishWaiter) OnError(effectType int, message string) {
+	if effectType == w.effectType {
+		w.message = message
+	}
+}
+
+// wait starts an effect and waits until it ends, the duration has passed or the command is interrupted.
+// An effect still running is stopped, which switches the LED off.
+func (e *env) wait(effectType int, start func() error) error {
+	waiter := &finishWaiter{effectType: effectType, finished: make(chan int, 1)}
+	e.c.SetEffectListener(waiter)
+	defer e.c.SetEffectListener(nil)
+
+	if err := start(); err != nil {
+		return err
+	}
+
+	var deadline <-chan time.Time
+	if e.duration > 0 {
+		timer := time.NewTimer(e.duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	select {
+	case reason := <-waiter.finished:
+		if reason == ledcontroller.FINISH_REASON_ERROR {
+			return fmt.Errorf("效果出错: %s", waiter.message)
+		}
+		return nil
+	case <-deadline:
+	case <-e.ctx.Done():
+	}
+	e.c.StopCurrentEffect()
+	return nil
+}
+
+// runRemote starts an effect in the daemon. With --duration it waits that long, or until the command
+// is interrupted, and stops the effect; otherwise the effect keeps running in the daemon.
+func (e *env) runRemote(effectType int) error {
+	decision, err := e.client.StartEffect(effectType)
+	if err != nil {
+		return err
+	}
+	if err := decisionError(decision, effectType); err != nil {
+		return err
+	}
+	if e.duration == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(e.duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-e.ctx.Done():
+	}
+	// 效果可能已经结束或被其他效果取代，只停止自己启动的效果
+	current, err := e.client.GetCurrentEffect()
+	if err != nil || current != effectType {
+		return err
+	}
+	return e.client.StopCurrentEffect()
+}
+
+// remoteStatus prints the daemon's status
+func (e *env) remoteStatus() error {
+	status, err := e.client.Status()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "backend:\t%s (lightd)\n", status.Backend)
+	if status.Color == "" {
+		fmt.Fprintln(tw, "color:\tunknown")
+	} else {
+		fmt.Fprintf(tw, "color:\t%s\n", status.Color)
+	}
+	fmt.Fprintf(tw, "effect:\t%s\n", status.EffectName)
+	fmt.Fprintf(tw, "enabled:\t%t\n", status.Enabled)
+	fmt.Fprintf(tw, "brightness:\t%d%%\n", status.Brightness)
+	fmt.Fprintf(tw, "clients:\t%d\n", status.Clients)
+	return tw.Flush()
+}
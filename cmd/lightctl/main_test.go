@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	ledcontroller "light"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	for _, tc := range []struct {
+		args       []string
+		positional []string
+		duration   time.Duration
+	}{
+		{nil, nil, 0},
+		{[]string{"blink"}, []string{"blink"}, 0},
+		{[]string{"--duration", "2s", "blink"}, []string{"blink"}, 2 * time.Second},
+		{[]string{"blink", "--duration=3s"}, []string{"blink"}, 3 * time.Second},
+		{[]string{"a", "-duration", "1s", "b"}, []string{"a", "b"}, time.Second},
+		// --之后都是位置参数
+		{[]string{"--", "--duration=1s"}, []string{"--duration=1s"}, 0},
+	} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		duration := flags.Duration("duration", 0, "")
+		positional, err := parseInterspersed(flags, tc.args)
+		if err != nil {
+			t.Errorf("%q: %v", tc.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, tc.positional) || *duration != tc.duration {
+			t.Errorf("%q = %q, duration %v, want %q, duration %v", tc.args, positional, *duration, tc.positional, tc.duration)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"blink", "--unknown"},
+		{"blink", "--duration"},
+		{"--duration", "soon", "blink"},
+	} {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.Duration("duration", 0, "")
+		if _, err := parseInterspersed(flags, args); err == nil {
+			t.Errorf("%q succeeded", args)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  ledcontroller.Color
+	}{
+		{"#ff8000", ledcontroller.Color{Red: 255, Green: 128}},
+		{"f80", ledcontroller.Color{Red: 255, Green: 136}},
+		{"orange", ledcontroller.Color{Red: 255, Green: 165}},
+		{"255,0,128", ledcontroller.Color{Red: 255, Blue: 128}},
+		{" 1, 2 ,3 ", ledcontroller.Color{Red: 1, Green: 2, Blue: 3}},
+		{"6500K", *ledcontroller.NewColorTemperature(6500)},
+	} {
+		color, err := parseColor(tc.value)
+		if err != nil {
+			t.Errorf("%q: %v", tc.value, err)
+			continue
+		}
+		if *color != tc.want {
+			t.Errorf("%q = %v, want %v", tc.value, *color, tc.want)
+		}
+	}
+
+	for _, value := range []string{"", "nocolor", "#12345", "256,0,0", "-1,0,0", "1,2", "1,2,3,4", "a,b,c", "1.5,0,0"} {
+		if _, err := parseColor(value); err == nil {
+			t.Errorf("%q succeeded", value)
+		}
+	}
+}
+
+func TestDecisionError(t *testing.T) {
+	for _, tc := range []struct {
+		decision int
+		want     string
+	}{
+		{ledcontroller.DECISION_STARTED, ""},
+		{ledcontroller.DECISION_PREEMPTED, ""},
+		{ledcontroller.DECISION_DIMMED, ""},
+		{ledcontroller.DECISION_SUBTLE, ""},
+		{ledcontroller.DECISION_QUEUED, "效果已排队，等待当前效果结束"},
+		{ledcontroller.DECISION_REJECTED, "效果3的优先级低于当前效果，已拒绝"},
+		{ledcontroller.DECISION_DISABLED, "LED已关闭"},
+		{ledcontroller.DECISION_SUPPRESSED, "勿扰模式已屏蔽效果3"},
+		{ledcontroller.DECISION_INVALID, "无效的效果类型: 3"},
+	} {
+		got := ""
+		if err := decisionError(tc.decision, ledcontroller.EFFECT_CALL); err != nil {
+			got = err.Error()
+		}
+		if got != tc.want {
+			t.Errorf("decision %d = %q, want %q", tc.decision, got, tc.want)
+		}
+	}
+}
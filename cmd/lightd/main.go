@@ -0,0 +1,82 @@
+// Command lightd owns the LEDs and serves them to other processes over a Unix domain socket.
+//
+// Usage:
+//
+//	lightd [--socket path] [--socket-mode mode] [--backend sysfs|sim] [--sysfs-root dir]
+//
+// Clients speak JSON-RPC 1.0, see package daemon, or use package client from Go.
+// On SIGINT or SIGTERM the daemon disconnects its clients, switches the LED off and removes the socket.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	ledcontroller "light"
+	"light/daemon"
+)
+
+func main() {
+	socketPath := flag.String("socket", daemon.DefaultSocketPath, "Unix domain socket to listen on")
+	socketMode := flag.String("socket-mode", "0660", "permissions of the socket, in octal")
+	backendName := flag.String("backend", "sysfs", "LED backend: sysfs or sim")
+	sysfsRoot := flag.String("sysfs-root", "", "sysfs mount point the sysfs backend discovers LEDs under (default /sys)")
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lightd: 无效的套接字权限: %s\n", *socketMode)
+		os.Exit(2)
+	}
+
+	options := &ledcontroller.ControllerOptions{}
+	switch *backendName {
+	case "sysfs":
+		// 后端为空时由控制器自动发现
+		if *sysfsRoot != "" {
+			options.Discovery = &ledcontroller.DiscoveryConfig{Root: *sysfsRoot}
+		}
+	case "sim":
+		// 守护进程长期运行，不保留写入记录
+		sim := ledcontroller.NewSimBackend()
+		sim.SetHistoryLimit(0)
+		options.Backend = sim
+	default:
+		fmt.Fprintf(os.Stderr, "lightd: 未知的后端: %s\n", *backendName)
+		os.Exit(2)
+	}
+
+	l, err := daemon.Listen(*socketPath, os.FileMode(mode))
+	if err != nil {
+		log.Fatalf("lightd: %v", err)
+	}
+
+	server := daemon.NewServer(ledcontroller.NewController(options))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		sig := <-signals
+		log.Printf("lightd: 收到%v，正在退出", sig)
+		if err := server.Close(); err != nil {
+			log.Printf("lightd: 关闭控制器失败: %v", err)
+		}
+	}()
+
+	log.Printf("lightd: 在%s上监听", *socketPath)
+	if err := server.Serve(l); err != nil {
+		log.Fatalf("lightd: %v", err)
+	}
+	// Serve在监听关闭时就返回，等LED关闭后再退出
+	<-closed
+}
@@ -0,0 +1,404 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Color temperature limits in kelvin
+const (
+	MIN_COLOR_TEMPERATURE = 1000
+	MAX_COLOR_TEMPERATURE = 40000
+)
+
+// HSV is a color as hue in degrees [0, 360), saturation and value in [0, 1]
+type HSV struct {
+	Hue        float64
+	Saturation float64
+	Value      float64
+}
+
+// HSL is a color as hue in degrees [0, 360), saturation and lightness in [0, 1]
+type HSL struct {
+	Hue        float64
+	Saturation float64
+	Lightness  float64
+}
+
+// ParseColor parses a color string. Accepted forms are #RRGGBB, #RGB (the # is optional),
+// CSS color names such as "orange" or "rebeccapurple", and color temperatures such as "2700K".
+func ParseColor(value string) (*Color, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	if s == "" {
+		return nil, fmt.Errorf("颜色字符串为空")
+	}
+
+	if named, ok := namedColors[strings.ReplaceAll(s, " ", "")]; ok {
+		color := named
+		return &color, nil
+	}
+	if strings.HasSuffix(s, "k") {
+		if kelvin, err := strconv.Atoi(strings.TrimSuffix(s, "k")); err == nil {
+			if kelvin < MIN_COLOR_TEMPERATURE || kelvin > MAX_COLOR_TEMPERATURE {
+				return nil, fmt.Errorf("色温必须在%d-%dK范围内", MIN_COLOR_TEMPERATURE, MAX_COLOR_TEMPERATURE)
+			}
+			return NewColorTemperature(kelvin), nil
+		}
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		// #RGB 每一位重复一次
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("无效的颜色: %q", value)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("无效的颜色: %q", value)
+	}
+	return &Color{int(rgb >> 16 & 0xFF), int(rgb >> 8 & 0xFF), int(rgb & 0xFF)}, nil
+}
+
+// Hex formats the color as #rrggbb, channels outside 0-255 are clamped
+func (c *Color) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", clampChannel(c.Red), clampChannel(c.Green), clampChannel(c.Blue))
+}
+
+// NewColorHSV creates a color from hue in degrees, saturation and value in [0, 1]
+func NewColorHSV(hue, saturation, value float64) *Color {
+	return hsvToColor(HSV{hue, saturation, value})
+}
+
+// NewColorHSL creates a color from hue in degrees, saturation and lightness in [0, 1]
+func NewColorHSL(hue, saturation, lightness float64) *Color {
+	s, l := clamp01(saturation), clamp01(lightness)
+	// 转换成HSV再计算RGB
+	v := l + s*math.Min(l, 1-l)
+	sv := 0.0
+	if v > 0 {
+		sv = 2 * (1 - l/v)
+	}
+	return hsvToColor(HSV{hue, sv, v})
+}
+
+// ToHSV converts the color to hue, saturation and value
+func (c *Color) ToHSV() *HSV {
+	r, g, b := channelUnit(c.Red), channelUnit(c.Green), channelUnit(c.Blue)
+	v := math.Max(r, math.Max(g, b))
+	chroma := v - math.Min(r, math.Min(g, b))
+
+	hsv := &HSV{Hue: rgbHue(r, g, b, v, chroma), Value: v}
+	if v > 0 {
+		hsv.Saturation = chroma / v
+	}
+	return hsv
+}
+
+// ToHSL converts the color to hue, saturation and lightness
+func (c *Color) ToHSL() *HSL {
+	r, g, b := channelUnit(c.Red), channelUnit(c.Green), channelUnit(c.Blue)
+	v := math.Max(r, math.Max(g, b))
+	chroma := v - math.Min(r, math.Min(g, b))
+	l := v - chroma/2
+
+	hsl := &HSL{Hue: rgbHue(r, g, b, v, chroma), Lightness: l}
+	if l > 0 && l < 1 {
+		hsl.Saturation = (v - l) / math.Min(l, 1-l)
+	}
+	return hsl
+}
+
+// NewColorTemperature approximates the color of a black body at a temperature in kelvin,
+// clamped to MIN_COLOR_TEMPERATURE-MAX_COLOR_TEMPERATURE
+func NewColorTemperature(kelvin int) *Color {
+	if kelvin < MIN_COLOR_TEMPERATURE {
+		kelvin = MIN_COLOR_TEMPERATURE
+	}
+	if kelvin > MAX_COLOR_TEMPERATURE {
+		kelvin = MAX_COLOR_TEMPERATURE
+	}
+	// Tanner Helland对黑体辐射颜色的拟合
+	t := float64(kelvin) / 100
+
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	return &Color{roundChannel(r), roundChannel(g), roundChannel(b)}
+}
+
+// ColorFromARGB converts an Android color int. The LED has no transparency,
+// so alpha scales the brightness and a fully transparent color is off.
+func ColorFromARGB(argb int32) *Color {
+	v := uint32(argb)
+	color := Color{int(v >> 16 & 0xFF), int(v >> 8 & 0xFF), int(v & 0xFF)}
+	if alpha := v >> 24; alpha != 0xFF {
+		color = scaleColor(color, float64(alpha)/255)
+	}
+	return &color
+}
+
+// ToARGB converts the color to an opaque Android color int
+func (c *Color) ToARGB() int32 {
+	v := uint32(0xFF)<<24 | uint32(clampChannel(c.Red))<<16 | uint32(clampChannel(c.Green))<<8 | uint32(clampChannel(c.Blue))
+	return int32(v)
+}
+
+// SetColorString stops all effects and sets a color given in any form ParseColor accepts
+func (c *Controller) SetColorString(value string) error {
+	color, err := ParseColor(value)
+	if err != nil {
+		return err
+	}
+	return c.EnableLED(*color)
+}
+
+// SetARGB stops all effects and sets an Android color int
+func (c *Controller) SetARGB(argb int32) error {
+	return c.EnableLED(*ColorFromARGB(argb))
+}
+
+// SetHSV stops all effects and sets a color from hue in degrees, saturation and value in [0, 1]
+func (c *Controller) SetHSV(hue, saturation, value float64) error {
+	return c.EnableLED(*NewColorHSV(hue, saturation, value))
+}
+
+// hsvToColor converts HSV to RGB, wrapping the hue and clamping saturation and value
+func hsvToColor(hsv HSV) *Color {
+	h := math.Mod(hsv.Hue, 360)
+	if h < 0 {
+		h += 360
+	}
+	s, v := clamp01(hsv.Saturation), clamp01(hsv.Value)
+
+	chroma := v * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = chroma, x, 0
+	case h < 120:
+		r, g, b = x, chroma, 0
+	case h < 180:
+		r, g, b = 0, chroma, x
+	case h < 240:
+		r, g, b = 0, x, chroma
+	case h < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	m := v - chroma
+	return &Color{roundChannel((r + m) * 255), roundChannel((g + m) * 255), roundChannel((b + m) * 255)}
+}
+
+// rgbHue returns the hue in degrees of unit RGB values with the given maximum and chroma
+func rgbHue(r, g, b, maxValue, chroma float64) float64 {
+	if chroma == 0 {
+		return 0
+	}
+	var h float64
+	switch maxValue {
+	case r:
+		h = math.Mod((g-b)/chroma, 6)
+	case g:
+		h = (b-r)/chroma + 2
+	default:
+		h = (r-g)/chroma + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// channelUnit maps a 0-255 channel value to [0, 1]
+func channelUnit(value int) float64 {
+	return float64(clampChannel(value)) / 255
+}
+
+// clampChannel limits a channel value to 0-255
+func clampChannel(value int) int {
+	if value < 0 {
+		return 0
+	}
+	if value > 255 {
+		return 255
+	}
+	return value
+}
+
+// roundChannel rounds and clamps a channel value to 0-255
+func roundChannel(value float64) int {
+	return clampChannel(int(math.Round(value)))
+}
+
+// namedColors are the CSS color names, plus "off"
+var namedColors = map[string]Color{
+	"off":                  ColorOff,
+	"aliceblue":            {240, 248, 255},
+	"antiquewhite":         {250, 235, 215},
+	"aqua":                 {0, 255, 255},
+	"aquamarine":           {127, 255, 212},
+	"azure":                {240, 255, 255},
+	"beige":                {245, 245, 220},
+	"bisque":               {255, 228, 196},
+	"black":                {0, 0, 0},
+	"blanchedalmond":       {255, 235, 205},
+	"blue":                 {0, 0, 255},
+	"blueviolet":           {138, 43, 226},
+	"brown":                {165, 42, 42},
+	"burlywood":            {222, 184, 135},
+	"cadetblue":            {95, 158, 160},
+	"chartreuse":           {127, 255, 0},
+	"chocolate":            {210, 105, 30},
+	"coral":                {255, 127, 80},
+	"cornflowerblue":       {100, 149, 237},
+	"cornsilk":             {255, 248, 220},
+	"crimson":              {220, 20, 60},
+	"cyan":                 {0, 255, 255},
+	"darkblue":             {0, 0, 139},
+	"darkcyan":             {0, 139, 139},
+	"darkgoldenrod":        {184, 134, 11},
+	"darkgray":             {169, 169, 169},
+	"darkgreen":            {0, 100, 0},
+	"darkgrey":             {169, 169, 169},
+	"darkkhaki":            {189, 183, 107},
+	"darkmagenta":          {139, 0, 139},
+	"darkolivegreen":       {85, 107, 47},
+	"darkorange":           {255, 140, 0},
+	"darkorchid":           {153, 50, 204},
+	"darkred":              {139, 0, 0},
+	"darksalmon":           {233, 150, 122},
+	"darkseagreen":         {143, 188, 143},
+	"darkslateblue":        {72, 61, 139},
+	"darkslategray":        {47, 79, 79},
+	"darkslategrey":        {47, 79, 79},
+	"darkturquoise":        {0, 206, 209},
+	"darkviolet":           {148, 0, 211},
+	"deeppink":             {255, 20, 147},
+	"deepskyblue":          {0, 191, 255},
+	"dimgray":              {105, 105, 105},
+	"dimgrey":              {105, 105, 105},
+	"dodgerblue":           {30, 144, 255},
+	"firebrick":            {178, 34, 34},
+	"floralwhite":          {255, 250, 240},
+	"forestgreen":          {34, 139, 34},
+	"fuchsia":              {255, 0, 255},
+	"gainsboro":            {220, 220, 220},
+	"ghostwhite":           {248, 248, 255},
+	"gold":                 {255, 215, 0},
+	"goldenrod":            {218, 165, 32},
+	"gray":                 {128, 128, 128},
+	"green":                {0, 128, 0},
+	"greenyellow":          {173, 255, 47},
+	"grey":                 {128, 128, 128},
+	"honeydew":             {240, 255, 240},
+	"hotpink":              {255, 105, 180},
+	"indianred":            {205, 92, 92},
+	"indigo":               {75, 0, 130},
+	"ivory":                {255, 255, 240},
+	"khaki":                {240, 230, 140},
+	"lavender":             {230, 230, 250},
+	"lavenderblush":        {255, 240, 245},
+	"lawngreen":            {124, 252, 0},
+	"lemonchiffon":         {255, 250, 205},
+	"lightblue":            {173, 216, 230},
+	"lightcoral":           {240, 128, 128},
+	"lightcyan":            {224, 255, 255},
+	"lightgoldenrodyellow": {250, 250, 210},
+	"lightgray":            {211, 211, 211},
+	"lightgreen":           {144, 238, 144},
+	"lightgrey":            {211, 211, 211},
+	"lightpink":            {255, 182, 193},
+	"lightsalmon":          {255, 160, 122},
+	"lightseagreen":        {32, 178, 170},
+	"lightskyblue":         {135, 206, 250},
+	"lightslategray":       {119, 136, 153},
+	"lightslategrey":       {119, 136, 153},
+	"lightsteelblue":       {176, 196, 222},
+	"lightyellow":          {255, 255, 224},
+	"lime":                 {0, 255, 0},
+	"limegreen":            {50, 205, 50},
+	"linen":                {250, 240, 230},
+	"magenta":              {255, 0, 255},
+	"maroon":               {128, 0, 0},
+	"mediumaquamarine":     {102, 205, 170},
+	"mediumblue":           {0, 0, 205},
+	"mediumorchid":         {186, 85, 211},
+	"mediumpurple":         {147, 112, 219},
+	"mediumseagreen":       {60, 179, 113},
+	"mediumslateblue":      {123, 104, 238},
+	"mediumspringgreen":    {0, 250, 154},
+	"mediumturquoise":      {72, 209, 204},
+	"mediumvioletred":      {199, 21, 133},
+	"midnightblue":         {25, 25, 112},
+	"mintcream":            {245, 255, 250},
+	"mistyrose":            {255, 228, 225},
+	"moccasin":             {255, 228, 181},
+	"navajowhite":          {255, 222, 173},
+	"navy":                 {0, 0, 128},
+	"oldlace":              {253, 245, 230},
+	"olive":                {128, 128, 0},
+	"olivedrab":            {107, 142, 35},
+	"orange":               {255, 165, 0},
+	"orangered":            {255, 69, 0},
+	"orchid":               {218, 112, 214},
+	"palegoldenrod":        {238, 232, 170},
+	"palegreen":            {152, 251, 152},
+	"paleturquoise":        {175, 238, 238},
+	"palevioletred":        {219, 112, 147},
+	"papayawhip":           {255, 239, 213},
+	"peachpuff":            {255, 218, 185},
+	"peru":                 {205, 133, 63},
+	"pink":                 {255, 192, 203},
+	"plum":                 {221, 160, 221},
+	"powderblue":           {176, 224, 230},
+	"purple":               {128, 0, 128},
+	"rebeccapurple":        {102, 51, 153},
+	"red":                  {255, 0, 0},
+	"rosybrown":            {188, 143, 143},
+	"royalblue":            {65, 105, 225},
+	"saddlebrown":          {139, 69, 19},
+	"salmon":               {250, 128, 114},
+	"sandybrown":           {244, 164, 96},
+	"seagreen":             {46, 139, 87},
+	"seashell":             {255, 245, 238},
+	"sienna":               {160, 82, 45},
+	"silver":               {192, 192, 192},
+	"skyblue":              {135, 206, 235},
+	"slateblue":            {106, 90, 205},
+	"slategray":            {112, 128, 144},
+	"slategrey":            {112, 128, 144},
+	"snow":                 {255, 250, 250},
+	"springgreen":          {0, 255, 127},
+	"steelblue":            {70, 130, 180},
+	"tan":                  {210, 180, 140},
+	"teal":                 {0, 128, 128},
+	"thistle":              {216, 191, 216},
+	"tomato":               {255, 99, 71},
+	"turquoise":            {64, 224, 208},
+	"violet":               {238, 130, 238},
+	"wheat":                {245, 222, 179},
+	"white":                {255, 255, 255},
+	"whitesmoke":           {245, 245, 245},
+	"yellow":               {255, 255, 0},
+	"yellowgreen":          {154, 205, 50},
+}
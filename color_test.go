@@ -0,0 +1,212 @@
+package ledcontroller
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  Color
+	}{
+		{"#FF8000", Color{255, 128, 0}},
+		{"ff8000", Color{255, 128, 0}},
+		{"#f80", Color{255, 136, 0}},
+		{"F80", Color{255, 136, 0}},
+		{"#000000", ColorOff},
+		{" Orange ", Color{255, 165, 0}},
+		{"Rebecca Purple", Color{102, 51, 153}},
+		{"off", ColorOff},
+		{"2700K", Color{255, 167, 87}},
+		{"6600k", Color{255, 255, 255}},
+	} {
+		color, err := ParseColor(tc.value)
+		if err != nil {
+			t.Errorf("%q: %v", tc.value, err)
+			continue
+		}
+		if *color != tc.want {
+			t.Errorf("%q = %v, want %v", tc.value, *color, tc.want)
+		}
+	}
+
+	for _, value := range []string{
+		"",
+		"  ",
+		"#",
+		"#12",
+		"#1234",
+		"#12345",
+		"#1234567",
+		"#ff80000f",
+		"#gggggg",
+		"#-12345",
+		"notacolor",
+		"999K",
+		"40001K",
+		"K",
+	} {
+		if color, err := ParseColor(value); err == nil {
+			t.Errorf("%q = %v, want an error", value, *color)
+		}
+	}
+}
+
+func TestColorHex(t *testing.T) {
+	for _, tc := range []struct {
+		color Color
+		want  string
+	}{
+		{ColorOff, "#000000"},
+		{Color{255, 128, 1}, "#ff8001"},
+		// 超出范围的通道被截断
+		{Color{300, -5, 16}, "#ff0010"},
+	} {
+		if hex := tc.color.Hex(); hex != tc.want {
+			t.Errorf("%v.Hex() = %s, want %s", tc.color, hex, tc.want)
+		}
+	}
+}
+
+func TestNewColorHSV(t *testing.T) {
+	for _, tc := range []struct {
+		hue, saturation, value float64
+		want                   Color
+	}{
+		{0, 1, 1, Color{255, 0, 0}},
+		{120, 1, 1, Color{0, 255, 0}},
+		{240, 1, 0.5, Color{0, 0, 128}},
+		{30, 1, 1, Color{255, 128, 0}},
+		{0, 0, 1, Color{255, 255, 255}},
+		{200, 0.5, 0, ColorOff},
+		// 色相超出0-360时回绕
+		{360, 1, 1, Color{255, 0, 0}},
+		{480, 1, 1, Color{0, 255, 0}},
+		{-120, 1, 1, Color{0, 0, 255}},
+		// 饱和度和明度截断到0-1
+		{0, 2, 1, Color{255, 0, 0}},
+		{0, -1, 1, Color{255, 255, 255}},
+		{120, 1, 1.5, Color{0, 255, 0}},
+		{120, 1, -0.5, ColorOff},
+	} {
+		if color := NewColorHSV(tc.hue, tc.saturation, tc.value); *color != tc.want {
+			t.Errorf("NewColorHSV(%v, %v, %v) = %v, want %v", tc.hue, tc.saturation, tc.value, *color, tc.want)
+		}
+	}
+}
+
+func TestNewColorHSL(t *testing.T) {
+	for _, tc := range []struct {
+		hue, saturation, lightness float64
+		want                       Color
+	}{
+		{0, 1, 0.5, Color{255, 0, 0}},
+		{120, 1, 0.25, Color{0, 128, 0}},
+		{60, 1, 0.75, Color{255, 255, 128}},
+		{0, 0, 0.5, Color{128, 128, 128}},
+		{0, 1, 1, Color{255, 255, 255}},
+		{0, 1, 0, ColorOff},
+		// 色相回绕，饱和度和亮度截断
+		{420, 2, 0.5, Color{255, 255, 0}},
+		{-60, 1, 0.5, Color{255, 0, 255}},
+		{240, -1, 0.5, Color{128, 128, 128}},
+		{240, 1, 2, Color{255, 255, 255}},
+		{240, 1, -1, ColorOff},
+	} {
+		if color := NewColorHSL(tc.hue, tc.saturation, tc.lightness); *color != tc.want {
+			t.Errorf("NewColorHSL(%v, %v, %v) = %v, want %v", tc.hue, tc.saturation, tc.lightness, *color, tc.want)
+		}
+	}
+}
+
+func TestColorToHSVAndHSL(t *testing.T) {
+	for _, tc := range []struct {
+		color Color
+		hsv   HSV
+		hsl   HSL
+	}{
+		{ColorOff, HSV{0, 0, 0}, HSL{0, 0, 0}},
+		{Color{255, 255, 255}, HSV{0, 0, 1}, HSL{0, 0, 1}},
+		{Color{255, 0, 0}, HSV{0, 1, 1}, HSL{0, 1, 0.5}},
+		{Color{0, 0, 255}, HSV{240, 1, 1}, HSL{240, 1, 0.5}},
+		{Color{255, 0, 255}, HSV{300, 1, 1}, HSL{300, 1, 0.5}},
+		{Color{0, 128, 0}, HSV{120, 1, 128.0 / 255}, HSL{120, 1, 64.0 / 255}},
+		{Color{255, 255, 128}, HSV{60, 127.0 / 255, 1}, HSL{60, 1, 191.5 / 255}},
+	} {
+		hsv := tc.color.ToHSV()
+		if !near(hsv.Hue, tc.hsv.Hue) || !near(hsv.Saturation, tc.hsv.Saturation) || !near(hsv.Value, tc.hsv.Value) {
+			t.Errorf("%v.ToHSV() = %+v, want %+v", tc.color, *hsv, tc.hsv)
+		}
+		hsl := tc.color.ToHSL()
+		if !near(hsl.Hue, tc.hsl.Hue) || !near(hsl.Saturation, tc.hsl.Saturation) || !near(hsl.Lightness, tc.hsl.Lightness) {
+			t.Errorf("%v.ToHSL() = %+v, want %+v", tc.color, *hsl, tc.hsl)
+		}
+
+		// 转换回RGB得到原来的颜色
+		if back := NewColorHSV(hsv.Hue, hsv.Saturation, hsv.Value); *back != tc.color {
+			t.Errorf("%v through HSV = %v", tc.color, *back)
+		}
+		if back := NewColorHSL(hsl.Hue, hsl.Saturation, hsl.Lightness); *back != tc.color {
+			t.Errorf("%v through HSL = %v", tc.color, *back)
+		}
+	}
+}
+
+func TestNewColorTemperature(t *testing.T) {
+	for _, tc := range []struct {
+		kelvin int
+		want   Color
+	}{
+		{1000, Color{255, 68, 0}},
+		{1900, Color{255, 132, 0}},
+		{2700, Color{255, 167, 87}},
+		{6500, Color{255, 254, 250}},
+		{6600, Color{255, 255, 255}},
+		{10000, Color{202, 218, 255}},
+		{40000, Color{152, 186, 255}},
+		// 超出范围时截断
+		{500, Color{255, 68, 0}},
+		{-1, Color{255, 68, 0}},
+		{50000, Color{152, 186, 255}},
+	} {
+		if color := NewColorTemperature(tc.kelvin); *color != tc.want {
+			t.Errorf("NewColorTemperature(%d) = %v, want %v", tc.kelvin, *color, tc.want)
+		}
+	}
+}
+
+func TestColorARGB(t *testing.T) {
+	for _, tc := range []struct {
+		argb uint32
+		want Color
+	}{
+		{0xFF000000, ColorOff},
+		{0xFFFF8000, Color{255, 128, 0}},
+		// 透明度按比例降低亮度
+		{0x80FF8000, Color{128, 64, 0}},
+		{0x00FFFFFF, ColorOff},
+	} {
+		if color := ColorFromARGB(int32(tc.argb)); *color != tc.want {
+			t.Errorf("ColorFromARGB(%#x) = %v, want %v", tc.argb, *color, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		color Color
+		want  uint32
+	}{
+		{ColorOff, 0xFF000000},
+		{Color{255, 128, 0}, 0xFFFF8000},
+		{Color{300, -1, 16}, 0xFFFF0010},
+	} {
+		if argb := tc.color.ToARGB(); uint32(argb) != tc.want {
+			t.Errorf("%v.ToARGB() = %#x, want %#x", tc.color, uint32(argb), tc.want)
+		}
+	}
+}
+
+// near reports whether two conversion results are equal up to rounding
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
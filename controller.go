@@ -0,0 +1,183 @@
+package ledcontroller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ControllerOptions configures a new Controller, zero values select the defaults
+type ControllerOptions struct {
+	// LED输出后端，为空时按Discovery自动发现
+	Backend Backend
+	// 自动发现使用的配置，为空时使用默认配置
+	Discovery *DiscoveryConfig
+	// 禁止把闪烁和呼吸效果交给内核触发器执行
+	DisableHardwareOffload bool
+	// 恢复后台效果时的交叉渐变时长（毫秒）
+	ResumeCrossfadeMs int
+	// 创建时LED总开关为关闭状态
+	StartDisabled bool
+	// 停止效果时等待效果退出的最长时间（毫秒），0表示使用默认值
+	StopTimeoutMs int
+	// 每次写入LED前应用的校准配置
+	Calibration *Calibration
+	// 主亮度百分比，0表示100
+	Brightness int
+	// 渐变的渲染帧率，0表示使用默认值
+	FrameRate int
+	// 控制器和所有效果使用的时钟，为空时使用系统时钟，测试时可以换成FakeClock
+	Clock Clock
+}
+
+// defaultStopTimeout is how long stopping an effect waits for it to exit
+const defaultStopTimeout = 2 * time.Second
+
+// Controller owns an LED backend and the effects running on it.
+// Each controller is independent, the package-level functions operate on a default one.
+type Controller struct {
+	mutex sync.Mutex
+	// 串行化对后端的颜色写入，保证重新写入的颜色不会覆盖更新的颜色
+	writeMutex sync.Mutex
+	// 串行化效果的启动和停止，持有期间会等待被停止的效果goroutine退出
+	runMutex sync.Mutex
+
+	backend Backend
+	clock   Clock
+
+	// 取消当前效果的context，以及效果goroutine退出时关闭的通道
+	cancelEffect context.CancelFunc
+	effectDone   chan struct{}
+	// 停止效果时等待goroutine退出的最长时间
+	stopTimeout time.Duration
+
+	effectActive      bool
+	currentEffectType int
+	// 每启动一个效果加一，用于识别已被取代的效果goroutine
+	effectGeneration int
+	// 停止超时后被放弃的效果，退出时按停止而不是打断上报
+	abandonedGeneration int
+	// 正在运行的效果请求，被打断时用于放入后台栈
+	currentRequest *effectRequest
+	ledEnabled     bool
+	// 是否允许把闪烁和呼吸效果交给内核触发器执行
+	hardwareOffload bool
+	// 当前生效的优先级配置
+	effectPriorities map[int]int
+
+	// 被打断或等待中的持续效果，栈顶在前：优先级高的在前，同优先级后入先出
+	backgroundEffects []*effectRequest
+	// 最近一次写入的颜色，恢复后台效果时作为交叉渐变的起点
+	lastColor Color
+
+	// 校准配置及编译后的查找表，nil表示不校准
+	calibration      *Calibration
+	calibrationTable *calibrationTable
+
+	// 主亮度百分比和夜间模式设置
+	brightness      int
+	nightMode       bool
+	nightBrightness int
+	nightWarm       bool
+	// 夜间模式的每日时间段（分钟），-1表示没有计划
+	nightStart int
+	nightEnd   int
+	nightTimer Timer
+	// 输出设置每次改变加一，内核触发器据此重新设置
+	outputVersion int
+
+	// 勿扰策略：手动设置的动作、每日时间段、按效果的例外和降低后的亮度
+	dndManual     int
+	quietHours    []*quietWindow
+	dndExceptions map[int]int
+	dndDimLevel   int
+	// 下一个勿扰时间段开始或结束时重新评估当前效果
+	quietTimer Timer
+	// 当前效果生效的勿扰动作，被勿扰模式降低了亮度
+	effectAction int
+	effectDimmed bool
+
+	// 音乐律动效果的音频分析
+	audio *audioAnalyzer
+	// 节奏同步效果使用的节拍时钟
+	tempo *tempoClock
+	// 渲染图案的goroutine
+	renderer *renderer
+	// 正在录制的输出轨迹，nil表示未录制
+	trace *traceRecorder
+
+	// 效果生命周期监听器和待送达的事件，由listenerMutex保护
+	listenerMutex sync.Mutex
+	listener      EffectListener
+	events        []func(listener EffectListener)
+	dispatching   bool
+
+	// 恢复后台效果时的交叉渐变时长，0表示不渐变
+	resumeCrossfade time.Duration
+	// 正在进行的交叉渐变
+	crossfadeFrom     Color
+	crossfadeStart    time.Time
+	crossfadeDuration time.Duration
+}
+
+// NewController creates a controller, options may be nil.
+// Without a backend it scans /sys/class/leds and falls back to the sc27xx paths.
+func NewController(options *ControllerOptions) *Controller {
+	if options == nil {
+		options = &ControllerOptions{}
+	}
+
+	clock := options.Clock
+	if clock == nil {
+		clock = SystemClock()
+	}
+
+	c := &Controller{
+		backend:          options.Backend,
+		clock:            clock,
+		stopTimeout:      defaultStopTimeout,
+		ledEnabled:       !options.StartDisabled,
+		hardwareOffload:  !options.DisableHardwareOffload,
+		effectPriorities: copyPriorities(defaultPriorities),
+		audio:            newAudioAnalyzer(clock),
+		tempo:            newTempoClock(clock),
+		brightness:       100,
+		nightBrightness:  DEFAULT_NIGHT_BRIGHTNESS,
+		nightWarm:        true,
+		nightStart:       -1,
+		nightEnd:         -1,
+		dndExceptions:    map[int]int{},
+		dndDimLevel:      DEFAULT_DND_DIM_LEVEL,
+	}
+	c.renderer = newRenderer(c, min(options.FrameRate, MAX_FRAME_RATE))
+	if options.ResumeCrossfadeMs > 0 {
+		c.resumeCrossfade = time.Duration(options.ResumeCrossfadeMs) * time.Millisecond
+	}
+	if options.Brightness > 0 && options.Brightness <= 100 {
+		c.brightness = options.Brightness
+	}
+	if options.StopTimeoutMs > 0 {
+		c.stopTimeout = time.Duration(options.StopTimeoutMs) * time.Millisecond
+	}
+
+	if options.Calibration != nil {
+		if table, err := options.Calibration.compile(); err == nil {
+			c.calibration = options.Calibration
+			c.calibrationTable = table
+		} else {
+			log.Printf("NewController: 忽略无效的校准配置: %v", err)
+		}
+	}
+
+	if c.backend == nil {
+		// 扫描/sys/class/leds，找不到时退回到sc27xx的固定路径
+		if b, err := DiscoverBackend(options.Discovery); err == nil {
+			c.backend = b
+		} else {
+			log.Printf("NewController: LED自动发现失败，使用默认路径: %v", err)
+			c.backend = NewSysfsBackend(RedLEDPath, GreenLEDPath, BlueLEDPath)
+		}
+	}
+	return c
+}
@@ -0,0 +1,68 @@
+// Package daemon serves one LED controller to other processes over a Unix domain socket,
+// so that every process on the device drives the LEDs through the same controller.
+//
+// The protocol is JSON-RPC 1.0 as implemented by net/rpc/jsonrpc: one JSON object per request,
+// for example
+//
+//	{"id": 1, "method": "Light.SetRGB", "params": [{"red": 255, "green": 0, "blue": 0}]}
+//
+// answered by {"id": 1, "result": {}, "error": null}. The client package wraps it for Go programs.
+package daemon
+
+// ServiceName is the RPC service the methods are registered under, e.g. "Light.StartEffect"
+const ServiceName = "Light"
+
+// DefaultSocketPath is where lightd listens unless told otherwise
+const DefaultSocketPath = "/dev/socket/lightd"
+
+// Empty is the argument and reply of methods that take or return nothing
+type Empty struct{}
+
+// StartEffectArgs selects the effect to start, by name when Name is set and by type otherwise
+type StartEffectArgs struct {
+	Effect int    `json:"effect"`
+	Name   string `json:"name,omitempty"`
+}
+
+// StartEffectReply is the arbitration decision, one of DECISION_*
+type StartEffectReply struct {
+	Effect   int  `json:"effect"`
+	Decision int  `json:"decision"`
+	Started  bool `json:"started"`
+}
+
+// SetRGBArgs is a color with 0-255 channels
+type SetRGBArgs struct {
+	Red   int `json:"red"`
+	Green int `json:"green"`
+	Blue  int `json:"blue"`
+}
+
+// SetLEDEnabledArgs is the new state of the master switch
+type SetLEDEnabledArgs struct {
+	Enabled bool `json:"enabled"`
+}
+
+// EffectReply is the running effect type and its name, EFFECT_NONE and "none" when idle
+type EffectReply struct {
+	Effect int    `json:"effect"`
+	Name   string `json:"name"`
+}
+
+// Status is a snapshot of the controller
+type Status struct {
+	Effect     int    `json:"effect"`
+	EffectName string `json:"effect_name"`
+	Enabled    bool   `json:"enabled"`
+	// 后端不支持读取时为空
+	Color      string `json:"color,omitempty"`
+	Brightness int    `json:"brightness"`
+	Backend    string `json:"backend"`
+
+	// 后端的写入计数，见WriteStats
+	WritesIssued  int `json:"writes_issued"`
+	WritesSkipped int `json:"writes_skipped"`
+	WritesFailed  int `json:"writes_failed"`
+	// 当前连接到守护进程的客户端数
+	Clients int `json:"clients"`
+}
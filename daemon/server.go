@@ -0,0 +1,264 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"sync"
+
+	ledcontroller "light"
+)
+
+// Server serves a controller to the clients connected to its listeners
+type Server struct {
+	c   *ledcontroller.Controller
+	rpc *rpc.Server
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewServer creates a server for a controller, which it owns from now on
+func NewServer(c *ledcontroller.Controller) *Server {
+	s := &Server{
+		c:         c,
+		rpc:       rpc.NewServer(),
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+	}
+	// 方法签名都符合net/rpc的要求，注册不会失败
+	if err := s.rpc.RegisterName(ServiceName, &service{s}); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Listen creates the Unix domain socket at path with the given permissions.
+// A socket left behind by a daemon that died is removed, one that still accepts connections is an error.
+// The socket is created in a private directory and only moved to path once it has its permissions,
+// closing the listener removes it.
+func Listen(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s已存在且不是套接字", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s上已有守护进程在运行", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("删除残留的套接字失败: %v", err)
+		}
+	}
+
+	// 先在只有自己能访问的临时目录里创建并设置权限，再移动到path，
+	// 避免chmod之前其他用户连接进来
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".lightd-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpPath := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("监听套接字失败: %v", err)
+	}
+	ul := l.(*net.UnixListener)
+	// 套接字移动之后由socketListener删除
+	ul.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		ul.Close()
+		return nil, fmt.Errorf("设置套接字权限失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		ul.Close()
+		return nil, fmt.Errorf("移动套接字失败: %v", err)
+	}
+	return &socketListener{UnixListener: ul, path: path}, nil
+}
+
+// socketListener removes the socket file of a listener created by Listen when it is closed
+type socketListener struct {
+	*net.UnixListener
+	path string
+	once sync.Once
+}
+
+// Close stops listening and removes the socket file
+func (l *socketListener) Close() error {
+	err := l.UnixListener.Close()
+	l.once.Do(func() { os.Remove(l.path) })
+	return err
+}
+
+// Serve accepts connections on l until the server is closed, serving each on its own goroutine.
+// It returns nil once Close was called.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("接受连接失败: %v", err)
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers the requests of one client until it disconnects
+func (s *Server) serveConn(conn net.Conn) {
+	log.Println("Server: 客户端已连接")
+	s.rpc.ServeCodec(jsonrpc.NewServerCodec(conn))
+	s.untrack(conn)
+	log.Println("Server: 客户端已断开")
+}
+
+// track records an open connection, returning false if the server is closed
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack forgets a closed connection
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// isClosed returns whether Close was called
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// clients returns the number of connected clients
+func (s *Server) clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Close stops accepting connections, disconnects every client and closes the controller,
+// which switches the LED off
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	return s.c.Close()
+}
+
+// service holds the RPC methods, registered as ServiceName
+type service struct {
+	s *Server
+}
+
+// StartEffect requests an effect, the reply carries the arbitration decision
+func (svc *service) StartEffect(args *StartEffectArgs, reply *StartEffectReply) error {
+	effectType := args.Effect
+	if args.Name != "" {
+		effectType = ledcontroller.EffectTypeByName(args.Name)
+		if effectType == ledcontroller.EFFECT_NONE {
+			return fmt.Errorf("未知的效果: %s", args.Name)
+		}
+	}
+
+	reply.Effect = effectType
+	reply.Decision = svc.s.c.RequestEffect(effectType)
+	switch reply.Decision {
+	case ledcontroller.DECISION_STARTED, ledcontroller.DECISION_PREEMPTED, ledcontroller.DECISION_QUEUED,
+		ledcontroller.DECISION_DIMMED, ledcontroller.DECISION_SUBTLE:
+		reply.Started = true
+	case ledcontroller.DECISION_INVALID:
+		return fmt.Errorf("无效的效果类型: %d", effectType)
+	}
+	return nil
+}
+
+// StopCurrentEffect stops the running effect and waits until the LED is off
+func (svc *service) StopCurrentEffect(args *Empty, reply *Empty) error {
+	svc.s.c.StopCurrentEffect()
+	return nil
+}
+
+// SetRGB stops all effects and shows a static color
+func (svc *service) SetRGB(args *SetRGBArgs, reply *Empty) error {
+	return svc.s.c.SetRGB(args.Red, args.Green, args.Blue)
+}
+
+// SetLEDEnabled switches the LED master switch
+func (svc *service) SetLEDEnabled(args *SetLEDEnabledArgs, reply *Empty) error {
+	svc.s.c.SetLEDEnabled(args.Enabled)
+	return nil
+}
+
+// GetCurrentEffect returns the running effect
+func (svc *service) GetCurrentEffect(args *Empty, reply *EffectReply) error {
+	reply.Effect = svc.s.c.GetCurrentEffect()
+	reply.Name = ledcontroller.EffectName(reply.Effect)
+	return nil
+}
+
+// Status returns a snapshot of the controller
+func (svc *service) Status(args *Empty, reply *Status) error {
+	c := svc.s.c
+	reply.Effect = c.GetCurrentEffect()
+	reply.EffectName = ledcontroller.EffectName(reply.Effect)
+	reply.Enabled = c.IsLEDEnabled()
+	if color, err := c.GetCurrentColor(); err == nil {
+		reply.Color = color.Hex()
+	}
+	reply.Brightness = c.GetBrightness()
+	reply.Backend = ledcontroller.BackendName(c.GetBackend())
+	stats := c.GetWriteStats()
+	reply.WritesIssued = stats.Issued
+	reply.WritesSkipped = stats.Skipped
+	reply.WritesFailed = stats.Failed
+	reply.Clients = svc.s.clients()
+	return nil
+}
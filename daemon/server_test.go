@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lightd")
+	l, err := Listen(path, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0660 {
+		t.Errorf("socket permissions = %o, want 660", perm)
+	}
+	// 临时目录不留下
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("directory holds %v (%v), want only the socket", entries, err)
+	}
+
+	if _, err := Listen(path, 0600); err == nil {
+		t.Error("Listen replaced the socket of a running daemon")
+	}
+}
+
+func TestListenCloseRemovesSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lightd")
+	l, err := Listen(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket still exists after Close: %v", err)
+	}
+
+	// 之后可以重新监听
+	l, err = Listen(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+}
@@ -0,0 +1,514 @@
+package ledcontroller
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultController backs the package-level functions, created on first use so that
+// programs that only create their own controllers never scan the LEDs for it
+var (
+	defaultController     *Controller
+	defaultControllerOnce sync.Once
+)
+
+// DefaultController returns the controller used by the package-level functions
+func DefaultController() *Controller {
+	defaultControllerOnce.Do(func() {
+		defaultController = NewController(nil)
+	})
+	return defaultController
+}
+
+// StopCurrentEffect stops any ongoing light effect and waits until it has exited and the LED is off.
+// A background effect, if any, resumes afterwards.
+func StopCurrentEffect() {
+	DefaultController().StopCurrentEffect()
+}
+
+// TurnOffLED turns off all LEDs
+func TurnOffLED() error {
+	return DefaultController().TurnOffLED()
+}
+
+// FadeColor implements a smooth transition from one color to another
+func FadeColor(ctx context.Context, from, to Color, duration time.Duration) error {
+	return DefaultController().FadeColor(ctx, from, to, duration)
+}
+
+// PulseColor implements a breathing effect for a specific color
+// If pulseCount is 0, it will continue indefinitely until stopped
+func PulseColor(ctx context.Context, color Color, pulseCount int, pulseDuration time.Duration) error {
+	return DefaultController().PulseColor(ctx, color, pulseCount, pulseDuration)
+}
+
+// BlinkColor implements a blinking effect for a specific color
+func BlinkColor(ctx context.Context, color Color, blinkCount int, onDuration, offDuration time.Duration) error {
+	return DefaultController().BlinkColor(ctx, color, blinkCount, onDuration, offDuration)
+}
+
+// CallNotificationEffect implements the call notification effect:
+// Red and blue alternating flashing (200ms on, 200ms off) until stopped
+func CallNotificationEffect() error {
+	return DefaultController().CallNotificationEffect()
+}
+
+// NotificationEffect implements notification effect:
+// Green breathing effect, each cycle 2s (1s brighten, 1s dim), continuously until stopped
+func NotificationEffect() error {
+	return DefaultController().NotificationEffect()
+}
+
+// MusicEffect implements music effect
+func MusicEffect() error {
+	return DefaultController().MusicEffect()
+}
+
+// BluetoothConnectingEffect implements Bluetooth connecting effect:
+// Blue flashing (300ms on, 500ms off)
+func BluetoothConnectingEffect() error {
+	return DefaultController().BluetoothConnectingEffect()
+}
+
+// BluetoothConnectedEffect implements Bluetooth connected effect:
+// Solid blue for 3 seconds
+func BluetoothConnectedEffect() error {
+	return DefaultController().BluetoothConnectedEffect()
+}
+
+// BluetoothFailedEffect implements Bluetooth connection failed effect:
+// Red flashing (200ms on, 400ms off) for 3 times
+func BluetoothFailedEffect() error {
+	return DefaultController().BluetoothFailedEffect()
+}
+
+// WiFiConnectingEffect implements WiFi connecting effect:
+// Green breathing effect with 1s transitions
+func WiFiConnectingEffect() error {
+	return DefaultController().WiFiConnectingEffect()
+}
+
+// WiFiConnectedEffect implements WiFi connected effect:
+// Solid green for 3 seconds
+func WiFiConnectedEffect() error {
+	return DefaultController().WiFiConnectedEffect()
+}
+
+// WiFiFailedEffect implements WiFi connection failed effect:
+// Red flashing (300ms on, 300ms off) for 3 times
+func WiFiFailedEffect() error {
+	return DefaultController().WiFiFailedEffect()
+}
+
+// PartyEffect implements a complex light show with different patterns over 9 seconds
+// Now loops continuously until stopped
+func PartyEffect() error {
+	return DefaultController().PartyEffect()
+}
+
+// ChargingLowBatteryEffect implements low battery charging effect:
+// Red breathing (1s brighten, 1s dim), continuously until stopped
+func ChargingLowBatteryEffect() error {
+	return DefaultController().ChargingLowBatteryEffect()
+}
+
+// ChargingHighBatteryEffect implements high battery charging effect:
+// Green breathing (1s brighten, 1s dim), continuously until stopped
+func ChargingHighBatteryEffect() error {
+	return DefaultController().ChargingHighBatteryEffect()
+}
+
+// ChargingCompleteEffect implements charging complete effect:
+// Solid blue light
+func ChargingCompleteEffect() error {
+	return DefaultController().ChargingCompleteEffect()
+}
+
+// CameraFocusEffect implements camera focus effect:
+// Solid orange for 2 seconds (R255 G128 B0)
+func CameraFocusEffect() error {
+	return DefaultController().CameraFocusEffect()
+}
+
+// CameraCaptureEffect implements camera capture effect:
+// Solid white for 1 second, then off for 0.5 second, then solid white for 0.2 second
+func CameraCaptureEffect() error {
+	return DefaultController().CameraCaptureEffect()
+}
+
+// CameraSavePhotoEffect implements camera save photo effect:
+// Solid green for 2 seconds
+func CameraSavePhotoEffect() error {
+	return DefaultController().CameraSavePhotoEffect()
+}
+
+// BootupEffect implements boot-up effect:
+// Complex sequence with smooth transitions and solid colors
+func BootupEffect() error {
+	return DefaultController().BootupEffect()
+}
+
+// SetRed sets only the red LED
+func SetRed(value int) error {
+	return DefaultController().SetRed(value)
+}
+
+// SetGreen sets only the green LED
+func SetGreen(value int) error {
+	return DefaultController().SetGreen(value)
+}
+
+// SetBlue sets only the blue LED
+func SetBlue(value int) error {
+	return DefaultController().SetBlue(value)
+}
+
+// EnableLED turns on the LED with the specified color
+func EnableLED(color Color) error {
+	return DefaultController().EnableLED(color)
+}
+
+// SetRGB sets the RGB values directly
+func SetRGB(red, green, blue int) error {
+	return DefaultController().SetRGB(red, green, blue)
+}
+
+// GetCurrentEffect returns the currently active effect type
+func GetCurrentEffect() int {
+	return DefaultController().GetCurrentEffect()
+}
+
+// GetCurrentColor reads the color currently shown by the backend
+func GetCurrentColor() (*Color, error) {
+	return DefaultController().GetCurrentColor()
+}
+
+// IsEffectActive returns whether an effect is currently running
+func IsEffectActive() bool {
+	return DefaultController().IsEffectActive()
+}
+
+// SetLEDEnabled Sets the LED enabled state
+func SetLEDEnabled(enabled bool) bool {
+	return DefaultController().SetLEDEnabled(enabled)
+}
+
+// IsLEDEnabled returns whether the LED is enabled
+func IsLEDEnabled() bool {
+	return DefaultController().IsLEDEnabled()
+}
+
+// StartEffect starts the specified effect
+// Returns true when the effect was started or queued, see RequestEffect for the full decision
+func StartEffect(effectType int) bool {
+	return DefaultController().StartEffect(effectType)
+}
+
+// SetEffectPriority overrides the priority of an effect type
+func SetEffectPriority(effectType, priority int) {
+	DefaultController().SetEffectPriority(effectType, priority)
+}
+
+// GetEffectPriority returns the priority of an effect type
+func GetEffectPriority(effectType int) int {
+	return DefaultController().GetEffectPriority(effectType)
+}
+
+// ResetEffectPriorities restores the default priorities
+func ResetEffectPriorities() {
+	DefaultController().ResetEffectPriorities()
+}
+
+// RequestEffect starts the specified effect subject to priority arbitration and returns the decision
+func RequestEffect(effectType int) int {
+	return DefaultController().RequestEffect(effectType)
+}
+
+// GetBackgroundEffect returns the effect that will resume when the current one ends
+func GetBackgroundEffect() int {
+	return DefaultController().GetBackgroundEffect()
+}
+
+// StopAllEffects stops the current effect and drops every background effect
+func StopAllEffects() {
+	DefaultController().StopAllEffects()
+}
+
+// SetResumeCrossfade sets how long a resumed background effect crossfades in, 0 disables it
+func SetResumeCrossfade(ms int) {
+	DefaultController().SetResumeCrossfade(ms)
+}
+
+// PlayEffect plays a loaded effect definition as EFFECT_CUSTOM
+func PlayEffect(def *EffectDefinition) error {
+	return DefaultController().PlayEffect(def)
+}
+
+// PlayEffectFile loads and plays a JSON effect file
+func PlayEffectFile(path string) error {
+	return DefaultController().PlayEffectFile(path)
+}
+
+// PlayEffectJSON parses and plays a JSON effect definition
+func PlayEffectJSON(data string) error {
+	return DefaultController().PlayEffectJSON(data)
+}
+
+// SetHardwareOffload enables or disables running blink and breathe effects on kernel triggers
+func SetHardwareOffload(enabled bool) {
+	DefaultController().SetHardwareOffload(enabled)
+}
+
+// IsHardwareOffloadEnabled returns whether kernel trigger offload is enabled
+func IsHardwareOffloadEnabled() bool {
+	return DefaultController().IsHardwareOffloadEnabled()
+}
+
+// SetBackend replaces the backend used by all effects and setters
+func SetBackend(b Backend) {
+	DefaultController().SetBackend(b)
+}
+
+// GetBackend returns the backend currently in use
+func GetBackend() Backend {
+	return DefaultController().GetBackend()
+}
+
+// DiscoverLEDs rescans the LED class devices and switches to the discovered backend
+func DiscoverLEDs(config *DiscoveryConfig) error {
+	return DefaultController().DiscoverLEDs(config)
+}
+
+// SetEffectListener registers the listener for effect lifecycle events, nil removes it
+func SetEffectListener(listener EffectListener) {
+	DefaultController().SetEffectListener(listener)
+}
+
+// PushPCM16 feeds interleaved little-endian 16 bit PCM to the audio-reactive effect
+func PushPCM16(data []byte, sampleRate, channels int) error {
+	return DefaultController().PushPCM16(data, sampleRate, channels)
+}
+
+// PushLevels feeds bass, mid and treble levels in [0, 1] to the audio-reactive effect,
+// for hosts that already run their own analysis such as the Android Visualizer
+func PushLevels(bass, mid, treble float64) {
+	DefaultController().PushLevels(bass, mid, treble)
+}
+
+// MusicReactiveEffect drives the LED live from pushed audio:
+// bass to red, mid to green, treble to blue, with a white flash on each beat, until stopped
+func MusicReactiveEffect() error {
+	return DefaultController().MusicReactiveEffect()
+}
+
+// FeedWAVFile pushes a 16 bit PCM WAV file to the audio-reactive effect in real time,
+// returning when the whole file has been played
+func FeedWAVFile(path string) error {
+	return DefaultController().FeedWAVFile(path)
+}
+
+// SetBPM sets the tempo followed by rhythmic effects, running effects are re-timed immediately
+func SetBPM(bpm float64) error {
+	return DefaultController().SetBPM(bpm)
+}
+
+// GetBPM returns the current tempo
+func GetBPM() float64 {
+	return DefaultController().GetBPM()
+}
+
+// SetBeatPhase declares where in the current beat the music is, 0 meaning exactly on a beat
+func SetBeatPhase(phase float64) error {
+	return DefaultController().SetBeatPhase(phase)
+}
+
+// GetBeatPhase returns the position within the current beat, in [0, 1)
+func GetBeatPhase() float64 {
+	return DefaultController().GetBeatPhase()
+}
+
+// Beat is the tap-tempo input: call it on every beat, the tempo is measured from
+// the recent calls and the beat phase aligned to the latest one
+func Beat() {
+	DefaultController().Beat()
+}
+
+// SetCalibration applies a calibration profile to every write, nil removes it
+func SetCalibration(cal *Calibration) error {
+	return DefaultController().SetCalibration(cal)
+}
+
+// GetCalibration returns the calibration profile in use, nil if uncalibrated
+func GetCalibration() *Calibration {
+	return DefaultController().GetCalibration()
+}
+
+// LoadCalibration loads a JSON calibration profile from a file and applies it
+func LoadCalibration(path string) error {
+	return DefaultController().LoadCalibration(path)
+}
+
+// SetChannelCalibration sets gamma, gain and minimum level of a single channel,
+// keeping the calibration of the other channels
+func SetChannelCalibration(channel int, gamma, gain float64, minLevel int) error {
+	return DefaultController().SetChannelCalibration(channel, gamma, gain, minLevel)
+}
+
+// SetBrightness sets the master brightness in percent, applied live to every write
+func SetBrightness(percent int) error {
+	return DefaultController().SetBrightness(percent)
+}
+
+// GetBrightness returns the master brightness in percent
+func GetBrightness() int {
+	return DefaultController().GetBrightness()
+}
+
+// SetNightMode switches night mode on or off manually, independent of the schedule
+func SetNightMode(enabled bool) {
+	DefaultController().SetNightMode(enabled)
+}
+
+// IsNightModeEnabled returns whether night mode was switched on manually
+func IsNightModeEnabled() bool {
+	return DefaultController().IsNightModeEnabled()
+}
+
+// IsNightModeActive returns whether night mode currently applies, manually or by schedule
+func IsNightModeActive() bool {
+	return DefaultController().IsNightModeActive()
+}
+
+// SetNightModeOptions sets the brightness cap in percent and whether colors turn warm in night mode
+func SetNightModeOptions(maxBrightness int, warm bool) error {
+	return DefaultController().SetNightModeOptions(maxBrightness, warm)
+}
+
+// SetNightSchedule turns night mode on every day between two local times,
+// in minutes since midnight. The window may span midnight, e.g. 22:00-07:00 is 1320, 420.
+func SetNightSchedule(startMinute, endMinute int) error {
+	return DefaultController().SetNightSchedule(startMinute, endMinute)
+}
+
+// ClearNightSchedule removes the night mode schedule
+func ClearNightSchedule() {
+	DefaultController().ClearNightSchedule()
+}
+
+// SetDoNotDisturb switches do-not-disturb on manually with the given action,
+// DND_ACTION_ALLOW switches it off. Quiet hours still apply.
+func SetDoNotDisturb(action int) error {
+	return DefaultController().SetDoNotDisturb(action)
+}
+
+// GetDoNotDisturb returns the manual do-not-disturb action
+func GetDoNotDisturb() int {
+	return DefaultController().GetDoNotDisturb()
+}
+
+// AddQuietHours adds a daily do-not-disturb window in minutes since local midnight,
+// which may span midnight. Where windows overlap the most restrictive action applies.
+func AddQuietHours(startMinute, endMinute, action int) error {
+	return DefaultController().AddQuietHours(startMinute, endMinute, action)
+}
+
+// ClearQuietHours removes every do-not-disturb window
+func ClearQuietHours() {
+	DefaultController().ClearQuietHours()
+}
+
+// SetDNDException overrides the action for an effect type while do-not-disturb is active,
+// e.g. DND_ACTION_ALLOW for EFFECT_CALL or DND_ACTION_SUPPRESS for EFFECT_PARTY
+func SetDNDException(effectType, action int) error {
+	return DefaultController().SetDNDException(effectType, action)
+}
+
+// RemoveDNDException removes the exception of an effect type
+func RemoveDNDException(effectType int) {
+	DefaultController().RemoveDNDException(effectType)
+}
+
+// ClearDNDExceptions removes every per-effect exception
+func ClearDNDExceptions() {
+	DefaultController().ClearDNDExceptions()
+}
+
+// SetDNDDimLevel sets the brightness in percent of effects dimmed by do-not-disturb
+func SetDNDDimLevel(percent int) error {
+	return DefaultController().SetDNDDimLevel(percent)
+}
+
+// GetDNDAction returns the action do-not-disturb would apply to an effect type right now
+func GetDNDAction(effectType int) int {
+	return DefaultController().GetDNDAction(effectType)
+}
+
+// SetColorString stops all effects and sets a color given in any form ParseColor accepts
+func SetColorString(value string) error {
+	return DefaultController().SetColorString(value)
+}
+
+// SetARGB stops all effects and sets an Android color int
+func SetARGB(argb int32) error {
+	return DefaultController().SetARGB(argb)
+}
+
+// SetHSV stops all effects and sets a color from hue in degrees, saturation and value in [0, 1]
+func SetHSV(hue, saturation, value float64) error {
+	return DefaultController().SetHSV(hue, saturation, value)
+}
+
+// FadeColorWith fades from one color to another with the given easing and color space,
+// nil is a linear fade in RGB
+func FadeColorWith(ctx context.Context, from, to Color, duration time.Duration, interp *Interpolation) error {
+	return DefaultController().FadeColorWith(ctx, from, to, duration, interp)
+}
+
+// PulseColorWith is PulseColor with the given easing and color space for both halves of each pulse.
+// The kernel pattern trigger only ramps linearly, so a non-nil interpolation or a calibration
+// always runs in software.
+func PulseColorWith(ctx context.Context, color Color, pulseCount int, pulseDuration time.Duration, interp *Interpolation) error {
+	return DefaultController().PulseColorWith(ctx, color, pulseCount, pulseDuration, interp)
+}
+
+// GetWriteStats returns the backend's write counters, all zero if the backend does not count writes
+func GetWriteStats() *WriteStats {
+	return DefaultController().GetWriteStats()
+}
+
+// ResetWriteStats sets the backend's write counters back to zero
+func ResetWriteStats() {
+	DefaultController().ResetWriteStats()
+}
+
+// Close stops all effects, switches the LED off and releases the files the backend keeps open.
+// The controller stays usable, later writes reopen the files.
+func Close() error {
+	return DefaultController().Close()
+}
+
+// SetFrameRate sets how many frames per second fading patterns are rendered at
+func SetFrameRate(frameRate int) error {
+	return DefaultController().SetFrameRate(frameRate)
+}
+
+// GetFrameRate returns the render frame rate in frames per second
+func GetFrameRate() int {
+	return DefaultController().GetFrameRate()
+}
+
+// StartTrace starts recording every color written to the backend, discarding any earlier recording
+func StartTrace() {
+	DefaultController().StartTrace()
+}
+
+// StopTrace stops recording and returns the trace, nil if no recording was running
+func StopTrace() *Trace {
+	return DefaultController().StopTrace()
+}
+
+// IsTracing returns whether a trace is being recorded
+func IsTracing() bool {
+	return DefaultController().IsTracing()
+}
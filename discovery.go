@@ -0,0 +1,180 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultSysfsRoot is where sysfs is mounted on the device
+const DefaultSysfsRoot = "/sys"
+
+// LED device colors reported by discovery
+const (
+	LED_COLOR_UNKNOWN    = ""
+	LED_COLOR_RED        = "red"
+	LED_COLOR_GREEN      = "green"
+	LED_COLOR_BLUE       = "blue"
+	LED_COLOR_MULTICOLOR = "multicolor"
+)
+
+// LEDDevice describes an LED class device found under /sys/class/leds
+type LEDDevice struct {
+	// 设备名，例如 sc27xx:red
+	Name string
+	// 设备目录
+	Path string
+	// 设备的max_brightness
+	MaxBrightness int
+	// 根据名字或配置识别出的颜色
+	Color string
+}
+
+// DiscoveryConfig controls how LED devices are matched to color channels.
+// The name patterns use path.Match syntax and take precedence over the built-in name matching.
+type DiscoveryConfig struct {
+	// sysfs挂载点，默认为/sys，测试时可以指向一个假的目录树
+	Root string
+	// 各通道的设备名匹配模式，例如 "sc27xx:red" 或 "*:red:*"
+	RedPattern   string
+	GreenPattern string
+	BluePattern  string
+}
+
+// colorNamePatterns matches the color part of common LED device names
+var colorNamePatterns = []struct {
+	color   string
+	pattern *regexp.Regexp
+}{
+	{LED_COLOR_RED, regexp.MustCompile(`(^|[^a-z])red([^a-z]|$)`)},
+	{LED_COLOR_GREEN, regexp.MustCompile(`(^|[^a-z])green([^a-z]|$)`)},
+	{LED_COLOR_BLUE, regexp.MustCompile(`(^|[^a-z])blue([^a-z]|$)`)},
+}
+
+// ledsDir returns the LED class directory below a sysfs root
+func ledsDir(root string) string {
+	if root == "" {
+		root = DefaultSysfsRoot
+	}
+	return filepath.Join(root, "class", "leds")
+}
+
+// ScanLEDs lists the LED class devices below the given sysfs root
+func ScanLEDs(config *DiscoveryConfig) ([]*LEDDevice, error) {
+	if config == nil {
+		config = &DiscoveryConfig{}
+	}
+
+	dir := ledsDir(config.Root)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("扫描LED目录失败: %v", err)
+	}
+
+	var devices []*LEDDevice
+	for _, entry := range entries {
+		devicePath := filepath.Join(dir, entry.Name())
+		// /sys/class/leds 下的条目是指向设备目录的符号链接
+		if info, err := os.Stat(devicePath); err != nil || !info.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(devicePath, "brightness")); err != nil {
+			continue
+		}
+
+		devices = append(devices, &LEDDevice{
+			Name:          entry.Name(),
+			Path:          devicePath,
+			MaxBrightness: readMaxBrightness(devicePath),
+			Color:         classifyLED(entry.Name(), devicePath, config),
+		})
+	}
+	return devices, nil
+}
+
+// classifyLED works out which color an LED device provides
+func classifyLED(name, devicePath string, config *DiscoveryConfig) string {
+	// 多色LED类设备有multi_index属性
+	if _, err := os.Stat(filepath.Join(devicePath, "multi_index")); err == nil {
+		return LED_COLOR_MULTICOLOR
+	}
+
+	// 配置的匹配模式优先，配置了模式的颜色不再使用内置的名字匹配
+	patterns := map[string]string{
+		LED_COLOR_RED:   config.RedPattern,
+		LED_COLOR_GREEN: config.GreenPattern,
+		LED_COLOR_BLUE:  config.BluePattern,
+	}
+	for _, color := range []string{LED_COLOR_RED, LED_COLOR_GREEN, LED_COLOR_BLUE} {
+		if patterns[color] == "" {
+			continue
+		}
+		if matched, _ := path.Match(patterns[color], name); matched {
+			return color
+		}
+	}
+
+	lower := strings.ToLower(name)
+	for _, p := range colorNamePatterns {
+		if p.pattern.MatchString(lower) && patterns[p.color] == "" {
+			return p.color
+		}
+	}
+	return LED_COLOR_UNKNOWN
+}
+
+// DiscoverBackend scans the LED class devices and builds a backend for the red, green and blue channels.
+// A multicolor device is preferred over separate single-color LEDs.
+func DiscoverBackend(config *DiscoveryConfig) (Backend, error) {
+	devices, err := ScanLEDs(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		if device.Color != LED_COLOR_MULTICOLOR {
+			continue
+		}
+		if b, err := NewMulticolorBackend(device.Path); err == nil {
+			return b, nil
+		}
+	}
+
+	// 每种颜色取排序后的第一个设备
+	found := map[string]*LEDDevice{}
+	for _, device := range devices {
+		if _, ok := found[device.Color]; !ok {
+			found[device.Color] = device
+		}
+	}
+
+	var missing []string
+	for _, color := range []string{LED_COLOR_RED, LED_COLOR_GREEN, LED_COLOR_BLUE} {
+		if found[color] == nil {
+			missing = append(missing, color)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("未找到LED设备: %s", strings.Join(missing, ", "))
+	}
+
+	return NewSysfsBackend(
+		filepath.Join(found[LED_COLOR_RED].Path, "brightness"),
+		filepath.Join(found[LED_COLOR_GREEN].Path, "brightness"),
+		filepath.Join(found[LED_COLOR_BLUE].Path, "brightness"),
+	), nil
+}
+
+// DiscoverLEDs rescans the LED class devices and switches to the discovered backend
+func (c *Controller) DiscoverLEDs(config *DiscoveryConfig) error {
+	b, err := DiscoverBackend(config)
+	if err != nil {
+		return err
+	}
+	c.SetBackend(b)
+	return nil
+}
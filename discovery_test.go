@@ -0,0 +1,208 @@
+package ledcontroller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeLED creates an LED class device with the given attributes below a fake sysfs root.
+// A brightness attribute holding 0 is added unless given.
+func fakeLED(t *testing.T, root, name string, attrs map[string]string) string {
+	t.Helper()
+	dir := filepath.Join(root, "class", "leds", name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := attrs["brightness"]; !ok {
+		writeTestAttr(t, dir, "brightness", "0")
+	}
+	for attr, value := range attrs {
+		writeTestAttr(t, dir, attr, value)
+	}
+	return dir
+}
+
+// writeTestAttr writes an attribute of a fake LED device
+func writeTestAttr(t *testing.T, dir, name, value string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestAttr reads an attribute of a fake LED device without surrounding whitespace
+func readTestAttr(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// fakeRGB creates red, green and blue LEDs sharing the given attributes and returns their directories
+func fakeRGB(t *testing.T, root string, attrs map[string]string) [3]string {
+	t.Helper()
+	var dirs [3]string
+	for channel, color := range []string{LED_COLOR_RED, LED_COLOR_GREEN, LED_COLOR_BLUE} {
+		dirs[channel] = fakeLED(t, root, "sc27xx:"+color, attrs)
+	}
+	return dirs
+}
+
+func TestScaleToDevice(t *testing.T) {
+	tests := []struct {
+		value, max, raw int
+	}{
+		{0, 255, 0},
+		{128, 255, 128},
+		{0, 4095, 0},
+		{1, 4095, 16},
+		{128, 4095, 2056},
+		{255, 4095, 4095},
+		{0, 1, 0},
+		{1, 1, 1},
+		{128, 1, 1},
+		{255, 1, 1},
+	}
+	for _, tt := range tests {
+		if raw := scaleToDevice(tt.value, tt.max); raw != tt.raw {
+			t.Errorf("scaleToDevice(%d, %d) = %d, want %d", tt.value, tt.max, raw, tt.raw)
+		}
+	}
+}
+
+func TestDiscoverSysfsMaxBrightness(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxBrightness string
+		value         int
+		// 写入brightness文件的值和读回的0-255值
+		raw      string
+		readBack int
+	}{
+		{"4095", "4095", 128, "2056", 128},
+		{"4095 full", "4095", 255, "4095", 255},
+		{"255", "255", 77, "77", 77},
+		{"1 on", "1", 128, "1", 255},
+		{"1 dim", "1", 1, "1", 255},
+		{"1 off", "1", 0, "0", 0},
+		{"missing", "", 200, "200", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			attrs := map[string]string{}
+			if tt.maxBrightness != "" {
+				attrs["max_brightness"] = tt.maxBrightness
+			}
+			dirs := fakeRGB(t, root, attrs)
+
+			b, err := DiscoverBackend(&DiscoveryConfig{Root: root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := b.(*SysfsBackend); !ok {
+				t.Fatalf("DiscoverBackend returned %T, want *SysfsBackend", b)
+			}
+			for channel := CHANNEL_RED; channel <= CHANNEL_BLUE; channel++ {
+				if err := b.WriteChannel(channel, tt.value); err != nil {
+					t.Fatal(err)
+				}
+				if raw := readTestAttr(t, dirs[channel], "brightness"); raw != tt.raw {
+					t.Errorf("channel %d brightness = %q, want %q", channel, raw, tt.raw)
+				}
+				if value, err := b.ReadChannel(channel); err != nil || value != tt.readBack {
+					t.Errorf("ReadChannel(%d) = %d, %v, want %d", channel, value, err, tt.readBack)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoverPrefersMulticolor(t *testing.T) {
+	root := t.TempDir()
+	fakeRGB(t, root, nil)
+	fakeLED(t, root, "rgb:status", map[string]string{
+		"multi_index":     "red green blue",
+		"multi_intensity": "0 0 0",
+	})
+
+	b, err := DiscoverBackend(&DiscoveryConfig{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.(*MulticolorBackend); !ok {
+		t.Fatalf("DiscoverBackend returned %T, want *MulticolorBackend", b)
+	}
+}
+
+func TestDiscoverPatterns(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"led0", "led1", "led2"} {
+		fakeLED(t, root, name, nil)
+	}
+
+	if _, err := DiscoverBackend(&DiscoveryConfig{Root: root}); err == nil {
+		t.Fatal("DiscoverBackend found LEDs without color names")
+	}
+	b, err := DiscoverBackend(&DiscoveryConfig{Root: root, RedPattern: "led2", GreenPattern: "led0", BluePattern: "led1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.WriteChannel(CHANNEL_RED, 9)
+	if raw := readTestAttr(t, filepath.Join(root, "class", "leds", "led2"), "brightness"); raw != "9" {
+		t.Errorf("red pattern wrote %q to led2, want 9", raw)
+	}
+}
+
+func TestMulticolorIndexOrder(t *testing.T) {
+	tests := []struct {
+		index         string
+		maxBrightness string
+		color         Color
+		intensity     string
+	}{
+		{"red green blue", "255", Color{10, 20, 30}, "10 20 30"},
+		{"blue green red", "255", Color{10, 20, 30}, "30 20 10"},
+		{"green white red blue", "255", Color{10, 20, 30}, "20 0 10 30"},
+		{"red green blue", "511", Color{255, 128, 0}, "511 257 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.index, func(t *testing.T) {
+			dir := fakeLED(t, t.TempDir(), "rgb:status", map[string]string{
+				"multi_index":     tt.index,
+				"multi_intensity": "",
+				"max_brightness":  tt.maxBrightness,
+			})
+			b, err := NewMulticolorBackend(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.WriteColor(tt.color); err != nil {
+				t.Fatal(err)
+			}
+			if intensity := readTestAttr(t, dir, "multi_intensity"); intensity != tt.intensity {
+				t.Errorf("multi_intensity = %q, want %q", intensity, tt.intensity)
+			}
+			if brightness := readTestAttr(t, dir, "brightness"); brightness != tt.maxBrightness {
+				t.Errorf("brightness = %q, want %q", brightness, tt.maxBrightness)
+			}
+			for channel, want := range []int{tt.color.Red, tt.color.Green, tt.color.Blue} {
+				if value, err := b.ReadChannel(channel); err != nil || value != want {
+					t.Errorf("ReadChannel(%d) = %d, %v, want %d", channel, value, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMulticolorMissingChannel(t *testing.T) {
+	dir := fakeLED(t, t.TempDir(), "rgb:status", map[string]string{"multi_index": "red green white"})
+	if _, err := NewMulticolorBackend(dir); err == nil {
+		t.Fatal("NewMulticolorBackend accepted multi_index without blue")
+	}
+}
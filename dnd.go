@@ -0,0 +1,272 @@
+package ledcontroller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Do-not-disturb actions, ordered from least to most restrictive
+const (
+	DND_ACTION_ALLOW    = 0 // 正常显示
+	DND_ACTION_DIM      = 1 // 降低亮度显示
+	DND_ACTION_SUBTLE   = 2 // 换成低亮度的缓慢呼吸
+	DND_ACTION_SUPPRESS = 3 // 不显示
+)
+
+const (
+	// 勿扰模式降低亮度时的默认亮度百分比
+	DEFAULT_DND_DIM_LEVEL = 30
+	// 柔和变体的亮度和呼吸周期
+	subtleLevel  = 0.15
+	subtlePeriod = 4 * time.Second
+)
+
+// subtleColors is the color of the subtle variant of each effect
+var subtleColors = map[int]Color{
+	EFFECT_BOOTUP:               ColorBlue,
+	EFFECT_NOTIFICATION:         ColorGreen,
+	EFFECT_CALL:                 ColorRed,
+	EFFECT_CHARGING_LOW:         ColorRed,
+	EFFECT_CHARGING_HIGH:        ColorGreen,
+	EFFECT_CHARGING_COMPLETE:    ColorBlue,
+	EFFECT_WIFI_CONNECTING:      ColorGreen,
+	EFFECT_WIFI_CONNECTED:       ColorGreen,
+	EFFECT_WIFI_FAILED:          ColorRed,
+	EFFECT_BLUETOOTH_CONNECTING: ColorBlue,
+	EFFECT_BLUETOOTH_CONNECTED:  ColorBlue,
+	EFFECT_BLUETOOTH_FAILED:     ColorRed,
+	EFFECT_CAMERA_FOCUS:         {255, 128, 0},
+	EFFECT_CAMERA_CAPTURE:       {255, 255, 255},
+	EFFECT_CAMERA_SAVE:          ColorGreen,
+	EFFECT_PARTY:                ColorBlue,
+	EFFECT_MUSIC:                ColorBlue,
+}
+
+// quietWindow is a daily do-not-disturb period in minutes since local midnight
+type quietWindow struct {
+	start  int
+	end    int
+	action int
+}
+
+// validDNDAction reports whether action is one of DND_ACTION_*
+func validDNDAction(action int) bool {
+	return action >= DND_ACTION_ALLOW && action <= DND_ACTION_SUPPRESS
+}
+
+// SetDoNotDisturb switches do-not-disturb on manually with the given action,
+// DND_ACTION_ALLOW switches it off. Quiet hours still apply.
+func (c *Controller) SetDoNotDisturb(action int) error {
+	if !validDNDAction(action) {
+		return fmt.Errorf("无效的勿扰动作: %d", action)
+	}
+	c.mutex.Lock()
+	c.dndManual = action
+	c.mutex.Unlock()
+	c.recheckDND()
+	return nil
+}
+
+// GetDoNotDisturb returns the manual do-not-disturb action
+func (c *Controller) GetDoNotDisturb() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.dndManual
+}
+
+// AddQuietHours adds a daily do-not-disturb window in minutes since local midnight,
+// which may span midnight. Where windows overlap the most restrictive action applies.
+func (c *Controller) AddQuietHours(startMinute, endMinute, action int) error {
+	if startMinute < 0 || startMinute >= MINUTES_PER_DAY || endMinute < 0 || endMinute >= MINUTES_PER_DAY {
+		return fmt.Errorf("时间必须在0-%d分钟范围内", MINUTES_PER_DAY-1)
+	}
+	if startMinute == endMinute {
+		return fmt.Errorf("开始和结束时间不能相同")
+	}
+	if !validDNDAction(action) {
+		return fmt.Errorf("无效的勿扰动作: %d", action)
+	}
+	c.mutex.Lock()
+	c.quietHours = append(c.quietHours, &quietWindow{startMinute, endMinute, action})
+	c.scheduleQuietBoundary()
+	c.mutex.Unlock()
+	c.recheckDND()
+	return nil
+}
+
+// ClearQuietHours removes every do-not-disturb window
+func (c *Controller) ClearQuietHours() {
+	c.mutex.Lock()
+	c.quietHours = nil
+	c.scheduleQuietBoundary()
+	c.mutex.Unlock()
+	c.recheckDND()
+}
+
+// SetDNDException overrides the action for an effect type while do-not-disturb is active,
+// e.g. DND_ACTION_ALLOW for EFFECT_CALL or DND_ACTION_SUPPRESS for EFFECT_PARTY
+func (c *Controller) SetDNDException(effectType, action int) error {
+	if !validDNDAction(action) {
+		return fmt.Errorf("无效的勿扰动作: %d", action)
+	}
+	c.mutex.Lock()
+	c.dndExceptions[effectType] = action
+	c.mutex.Unlock()
+	c.recheckDND()
+	return nil
+}
+
+// RemoveDNDException removes the exception of an effect type
+func (c *Controller) RemoveDNDException(effectType int) {
+	c.mutex.Lock()
+	delete(c.dndExceptions, effectType)
+	c.mutex.Unlock()
+	c.recheckDND()
+}
+
+// ClearDNDExceptions removes every per-effect exception
+func (c *Controller) ClearDNDExceptions() {
+	c.mutex.Lock()
+	c.dndExceptions = map[int]int{}
+	c.mutex.Unlock()
+	c.recheckDND()
+}
+
+// SetDNDDimLevel sets the brightness in percent of effects dimmed by do-not-disturb
+func (c *Controller) SetDNDDimLevel(percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("亮度必须在0-100范围内")
+	}
+	c.mutex.Lock()
+	c.dndDimLevel = percent
+	c.outputVersion++
+	c.mutex.Unlock()
+	c.reapplyColor()
+	return nil
+}
+
+// GetDNDAction returns the action do-not-disturb would apply to an effect type right now
+func (c *Controller) GetDNDAction(effectType int) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.dndAction(effectType, c.clock.Now())
+}
+
+// dndAction evaluates the policy for an effect type at a time, mutex must be held
+func (c *Controller) dndAction(effectType int, now time.Time) int {
+	action := c.dndManual
+	minute := minuteOfDay(now)
+	for _, window := range c.quietHours {
+		if inMinuteWindow(minute, window.start, window.end) && window.action > action {
+			action = window.action
+		}
+	}
+
+	// 例外只在勿扰生效期间起作用
+	if action == DND_ACTION_ALLOW {
+		return action
+	}
+	if exception, ok := c.dndExceptions[effectType]; ok {
+		return exception
+	}
+	return action
+}
+
+// scheduleQuietBoundary arms a timer for the next start or end of a quiet hours window,
+// mutex must be held
+func (c *Controller) scheduleQuietBoundary() {
+	if c.quietTimer != nil {
+		c.quietTimer.Stop()
+		c.quietTimer = nil
+	}
+	if len(c.quietHours) == 0 {
+		return
+	}
+
+	now := c.clock.Now()
+	var next time.Time
+	for _, window := range c.quietHours {
+		for _, minute := range []int{window.start, window.end} {
+			if boundary := nextMinuteOfDay(now, minute); next.IsZero() || boundary.Before(next) {
+				next = boundary
+			}
+		}
+	}
+	c.quietTimer = c.clock.AfterFunc(next.Sub(now), func() {
+		log.Println("scheduleQuietBoundary: 勿扰时间段切换")
+		c.mutex.Lock()
+		c.scheduleQuietBoundary()
+		c.mutex.Unlock()
+		c.recheckDND()
+	})
+}
+
+// recheckDND applies a policy change to the running effect. A change between allowed and dimmed
+// takes effect on the next write, a change to or from the subtle variant restarts the effect and
+// a suppressed effect is stopped, persistent ones waiting in the background until do-not-disturb lifts.
+func (c *Controller) recheckDND() {
+	c.mutex.Lock()
+	req := c.currentRequest
+	if !c.effectActive || req == nil {
+		// 空闲时恢复之前被屏蔽的后台效果
+		c.mutex.Unlock()
+		c.resumeBackgroundEffect()
+		return
+	}
+	action := c.dndAction(req.effectType, c.clock.Now())
+	previous := c.effectAction
+	if action == previous {
+		c.mutex.Unlock()
+		return
+	}
+	log.Printf("recheckDND: 效果%d的勿扰动作从%d变为%d", req.effectType, previous, action)
+	if action <= DND_ACTION_DIM && previous <= DND_ACTION_DIM {
+		c.effectAction = action
+		c.effectDimmed = action == DND_ACTION_DIM
+		c.outputVersion++
+		c.mutex.Unlock()
+		c.reapplyColor()
+		return
+	}
+	c.mutex.Unlock()
+
+	if action != DND_ACTION_SUPPRESS {
+		// 换成或换回柔和变体，从头开始效果
+		c.startTimedEffect(req)
+		return
+	}
+
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+	c.mutex.Lock()
+	current := c.currentRequest == req
+	if current && req.persistent {
+		c.pushBackgroundEffect(req)
+	}
+	c.mutex.Unlock()
+	if current {
+		log.Printf("recheckDND: 勿扰模式屏蔽了正在运行的效果%d", req.effectType)
+		c.stopRunningEffect(false)
+	}
+}
+
+// subtleEffect returns the subtle variant of an effect: a slow, faint breathe in its main color,
+// looping for persistent effects and played once otherwise
+func subtleEffect(req *effectRequest) func(c *Controller, ctx context.Context) error {
+	color, ok := subtleColors[req.effectType]
+	if !ok {
+		color = ColorBlue
+	}
+	color = scaleColor(color, subtleLevel)
+
+	repeat := 1
+	if req.persistent {
+		repeat = 0
+	}
+	log.Printf("subtleEffect: 效果%d改为柔和变体，颜色 %v", req.effectType, color)
+	return playing(NewTimeline(repeat).
+		Ease(ColorOff, color, subtlePeriod/2).
+		Ease(color, ColorOff, subtlePeriod/2))
+}
@@ -0,0 +1,66 @@
+package ledcontroller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHoursDimRunningEffect(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	defer c.StopAllEffects()
+
+	// 12:01到13:00降低亮度，时钟从12:00开始
+	if err := c.AddQuietHours(12*60+1, 13*60, DND_ACTION_DIM); err != nil {
+		t.Fatal(err)
+	}
+	white := Color{255, 255, 255}
+	if err := c.runTimedEffect(holding(c, white), EFFECT_CHARGING_HIGH); err != nil {
+		t.Fatal(err)
+	}
+	waitForColor(t, sim, white)
+
+	clock.Advance(time.Minute)
+	waitForColor(t, sim, Color{77, 77, 77})
+
+	// 调整降低后的亮度立即生效
+	if err := c.SetDNDDimLevel(50); err != nil {
+		t.Fatal(err)
+	}
+	waitForColor(t, sim, Color{128, 128, 128})
+
+	clock.Advance(59 * time.Minute)
+	waitForColor(t, sim, white)
+}
+
+func TestQuietHoursSuppressRunningEffect(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	defer c.StopAllEffects()
+
+	if err := c.AddQuietHours(12*60+1, 12*60+2, DND_ACTION_SUPPRESS); err != nil {
+		t.Fatal(err)
+	}
+	white := Color{255, 255, 255}
+	if err := c.runTimedEffect(holding(c, white), EFFECT_CHARGING_HIGH); err != nil {
+		t.Fatal(err)
+	}
+	waitForColor(t, sim, white)
+
+	// 勿扰开始时停止持续效果，放入后台
+	clock.Advance(time.Minute)
+	waitForColor(t, sim, ColorOff)
+	waitFor(t, "the effect to stop", func() bool { return !c.IsEffectActive() })
+	if background := c.GetBackgroundEffect(); background != EFFECT_CHARGING_HIGH {
+		t.Fatalf("background effect = %d, want %d", background, EFFECT_CHARGING_HIGH)
+	}
+
+	// 勿扰结束后恢复
+	clock.Advance(time.Minute)
+	waitForColor(t, sim, white)
+	if effect := c.GetCurrentEffect(); effect != EFFECT_CHARGING_HIGH {
+		t.Errorf("current effect after quiet hours = %d, want %d", effect, EFFECT_CHARGING_HIGH)
+	}
+}
@@ -0,0 +1,305 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Easing curves. Besides these names, "cubic-bezier(x1, y1, x2, y2)" defines a custom curve
+// like its CSS counterpart.
+const (
+	EASING_LINEAR      = "linear"
+	EASING_EASE_IN     = "ease-in"
+	EASING_EASE_OUT    = "ease-out"
+	EASING_EASE_IN_OUT = "ease-in-out"
+	EASING_SINE        = "sine"
+	EASING_CUBIC       = "cubic"
+	EASING_EXPO        = "expo"
+)
+
+// Color spaces colors are interpolated in
+const (
+	// 直接对0-255的值插值，与原有行为一致
+	COLOR_SPACE_RGB = "rgb"
+	// 线性光RGB，混合结果的亮度更自然
+	COLOR_SPACE_LINEAR_RGB = "linear-rgb"
+	// 色相沿最短方向变化
+	COLOR_SPACE_HSV = "hsv"
+	// CIE Lab，感知亮度均匀
+	COLOR_SPACE_LAB = "lab"
+)
+
+// easingCurves are the named easing curves, mapping progress in [0, 1] to [0, 1]
+var easingCurves = map[string]func(float64) float64{
+	EASING_LINEAR:      func(p float64) float64 { return p },
+	EASING_EASE_IN:     cubicBezier(0.42, 0, 1, 1),
+	EASING_EASE_OUT:    cubicBezier(0, 0, 0.58, 1),
+	EASING_EASE_IN_OUT: cubicBezier(0.42, 0, 0.58, 1),
+	EASING_SINE: func(p float64) float64 {
+		return (1 - math.Cos(math.Pi*p)) / 2
+	},
+	EASING_CUBIC: func(p float64) float64 {
+		if p < 0.5 {
+			return 4 * p * p * p
+		}
+		return 1 - math.Pow(2-2*p, 3)/2
+	},
+	EASING_EXPO: func(p float64) float64 {
+		switch {
+		case p <= 0:
+			return 0
+		case p >= 1:
+			return 1
+		case p < 0.5:
+			return math.Pow(2, 20*p-10) / 2
+		}
+		return (2 - math.Pow(2, 10-20*p)) / 2
+	},
+}
+
+// colorMixers are the interpolation functions of each color space
+var colorMixers = map[string]func(from, to Color, progress float64) Color{
+	COLOR_SPACE_RGB:        lerpColor,
+	COLOR_SPACE_LINEAR_RGB: mixLinearRGB,
+	COLOR_SPACE_HSV:        mixHSV,
+	COLOR_SPACE_LAB:        mixLab,
+}
+
+// Interpolation selects the easing curve and color space of a fade.
+// Empty fields mean linear easing in RGB, the behavior of a plain fade.
+type Interpolation struct {
+	Easing     string
+	ColorSpace string
+
+	// 解析后的曲线和插值函数，由compile生成
+	curve func(float64) float64
+	mix   func(from, to Color, progress float64) Color
+}
+
+// NewInterpolation creates and validates an interpolation, for example
+// NewInterpolation(EASING_SINE, COLOR_SPACE_LAB) or NewInterpolation("cubic-bezier(0.3, 0, 0.2, 1)", "")
+func NewInterpolation(easing, colorSpace string) (*Interpolation, error) {
+	return (&Interpolation{Easing: easing, ColorSpace: colorSpace}).compile()
+}
+
+// compile returns a validated copy with the curve and mixer resolved, the receiver is left untouched
+func (ip *Interpolation) compile() (*Interpolation, error) {
+	compiled := &Interpolation{}
+	if ip != nil {
+		compiled.Easing, compiled.ColorSpace = ip.Easing, ip.ColorSpace
+	}
+
+	curve, err := parseEasing(compiled.Easing)
+	if err != nil {
+		return nil, err
+	}
+	space := strings.ToLower(strings.TrimSpace(compiled.ColorSpace))
+	if space == "" {
+		space = COLOR_SPACE_RGB
+	}
+	mix, ok := colorMixers[space]
+	if !ok {
+		return nil, fmt.Errorf("无效的颜色空间: %q", compiled.ColorSpace)
+	}
+	compiled.curve, compiled.mix = curve, mix
+	return compiled, nil
+}
+
+// color returns the interpolated color at progress in [0, 1]
+func (ip *Interpolation) color(from, to Color, progress float64) Color {
+	if ip.curve == nil || ip.mix == nil {
+		// 未经compile的对象每次临时解析，无效时退回线性RGB
+		compiled, err := ip.compile()
+		if err != nil {
+			return lerpColor(from, to, progress)
+		}
+		ip = compiled
+	}
+	return ip.mix(from, to, ip.curve(clamp01(progress)))
+}
+
+// parseEasing resolves an easing name or cubic-bezier definition, empty means linear
+func parseEasing(easing string) (func(float64) float64, error) {
+	name := strings.ToLower(strings.TrimSpace(easing))
+	if name == "" {
+		return easingCurves[EASING_LINEAR], nil
+	}
+	if curve, ok := easingCurves[name]; ok {
+		return curve, nil
+	}
+
+	if strings.HasPrefix(name, "cubic-bezier(") && strings.HasSuffix(name, ")") {
+		args := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, "cubic-bezier("), ")"), ",")
+		var points [4]float64
+		if len(args) != len(points) {
+			return nil, fmt.Errorf("cubic-bezier需要4个参数: %q", easing)
+		}
+		for i, arg := range args {
+			point, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil || math.IsNaN(point) || math.IsInf(point, 0) {
+				return nil, fmt.Errorf("无效的cubic-bezier参数: %q", easing)
+			}
+			points[i] = point
+		}
+		// 与CSS相同，x坐标必须在[0, 1]内，曲线才是时间的函数
+		if points[0] < 0 || points[0] > 1 || points[2] < 0 || points[2] > 1 {
+			return nil, fmt.Errorf("cubic-bezier的x坐标必须在0-1范围内: %q", easing)
+		}
+		return cubicBezier(points[0], points[1], points[2], points[3]), nil
+	}
+	return nil, fmt.Errorf("无效的缓动曲线: %q", easing)
+}
+
+// cubicBezier returns the easing curve through (0,0) and (1,1) with control points (x1,y1) and (x2,y2)
+func cubicBezier(x1, y1, x2, y2 float64) func(float64) float64 {
+	bezier := func(t, p1, p2 float64) float64 {
+		u := 1 - t
+		return 3*u*u*t*p1 + 3*u*t*t*p2 + t*t*t
+	}
+	slope := func(t, p1, p2 float64) float64 {
+		u := 1 - t
+		return 3*u*u*p1 + 6*u*t*(p2-p1) + 3*t*t*(1-p2)
+	}
+
+	return func(x float64) float64 {
+		if x <= 0 || x >= 1 {
+			return clamp01(x)
+		}
+		// 牛顿迭代求x对应的参数t，斜率太小时改用二分法
+		t := x
+		for i := 0; i < 8; i++ {
+			dx := bezier(t, x1, x2) - x
+			if math.Abs(dx) < 1e-6 {
+				return bezier(t, y1, y2)
+			}
+			d := slope(t, x1, x2)
+			if math.Abs(d) < 1e-6 {
+				break
+			}
+			t -= dx / d
+		}
+
+		low, high := 0.0, 1.0
+		t = x
+		for i := 0; i < 32; i++ {
+			if bezier(t, x1, x2) < x {
+				low = t
+			} else {
+				high = t
+			}
+			t = (low + high) / 2
+		}
+		return bezier(t, y1, y2)
+	}
+}
+
+// mixLinearRGB interpolates in linear-light RGB
+func mixLinearRGB(from, to Color, progress float64) Color {
+	mix := func(a, b int) int {
+		la, lb := srgbToLinear(channelUnit(a)), srgbToLinear(channelUnit(b))
+		return roundChannel(255 * linearToSRGB(la+(lb-la)*progress))
+	}
+	return Color{mix(from.Red, to.Red), mix(from.Green, to.Green), mix(from.Blue, to.Blue)}
+}
+
+// mixHSV interpolates in HSV along the shorter way around the hue circle
+func mixHSV(from, to Color, progress float64) Color {
+	a, b := from.ToHSV(), to.ToHSV()
+	// 黑色和灰色没有色相，沿用另一端的色相，避免经过无关的颜色
+	if a.Saturation == 0 || a.Value == 0 {
+		a.Hue = b.Hue
+	}
+	if b.Saturation == 0 || b.Value == 0 {
+		b.Hue = a.Hue
+	}
+
+	dh := math.Mod(b.Hue-a.Hue+540, 360) - 180
+	return *hsvToColor(HSV{
+		Hue:        a.Hue + dh*progress,
+		Saturation: a.Saturation + (b.Saturation-a.Saturation)*progress,
+		Value:      a.Value + (b.Value-a.Value)*progress,
+	})
+}
+
+// mixLab interpolates in CIE Lab, so perceived brightness changes evenly
+func mixLab(from, to Color, progress float64) Color {
+	a, b := colorToLab(from), colorToLab(to)
+	var lab [3]float64
+	for i := range lab {
+		lab[i] = a[i] + (b[i]-a[i])*progress
+	}
+	return labToColor(lab)
+}
+
+// D65白点和Lab转换常数
+const (
+	whiteX   = 0.95047
+	whiteY   = 1.0
+	whiteZ   = 1.08883
+	labDelta = 6.0 / 29
+)
+
+// colorToLab converts an sRGB color to CIE Lab under D65
+func colorToLab(color Color) [3]float64 {
+	r := srgbToLinear(channelUnit(color.Red))
+	g := srgbToLinear(channelUnit(color.Green))
+	b := srgbToLinear(channelUnit(color.Blue))
+
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// labToColor converts CIE Lab under D65 to sRGB, clamping colors outside the gamut
+func labToColor(lab [3]float64) Color {
+	fy := (lab[0] + 16) / 116
+	x := labFInverse(fy+lab[1]/500) * whiteX
+	y := labFInverse(fy) * whiteY
+	z := labFInverse(fy-lab[2]/200) * whiteZ
+
+	r := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b := 0.0556434*x - 0.2040259*y + 1.0572252*z
+	return Color{
+		roundChannel(255 * linearToSRGB(clamp01(r))),
+		roundChannel(255 * linearToSRGB(clamp01(g))),
+		roundChannel(255 * linearToSRGB(clamp01(b))),
+	}
+}
+
+// labF is the Lab companding function
+func labF(t float64) float64 {
+	if t > labDelta*labDelta*labDelta {
+		return math.Cbrt(t)
+	}
+	return t/(3*labDelta*labDelta) + 4.0/29
+}
+
+// labFInverse inverts labF
+func labFInverse(t float64) float64 {
+	if t > labDelta {
+		return t * t * t
+	}
+	return 3 * labDelta * labDelta * (t - 4.0/29)
+}
+
+// srgbToLinear removes the sRGB gamma from a value in [0, 1]
+func srgbToLinear(value float64) float64 {
+	if value <= 0.04045 {
+		return value / 12.92
+	}
+	return math.Pow((value+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB applies the sRGB gamma to a linear value in [0, 1]
+func linearToSRGB(value float64) float64 {
+	if value <= 0.0031308 {
+		return value * 12.92
+	}
+	return 1.055*math.Pow(value, 1/2.4) - 0.055
+}
@@ -0,0 +1,61 @@
+package ledcontroller
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseEasing(t *testing.T) {
+	for _, tc := range []struct {
+		easing string
+		// 进度为0.25、0.5和0.75时的值
+		want [3]float64
+	}{
+		{"", [3]float64{0.25, 0.5, 0.75}},
+		{"Linear", [3]float64{0.25, 0.5, 0.75}},
+		{" sine ", [3]float64{0.1464, 0.5, 0.8536}},
+		{"cubic", [3]float64{0.0625, 0.5, 0.9375}},
+		{"ease-in-out", [3]float64{0.1292, 0.5, 0.8708}},
+		{"cubic-bezier(0.42, 0, 0.58, 1)", [3]float64{0.1292, 0.5, 0.8708}},
+		{"cubic-bezier(0,0,1,1)", [3]float64{0.25, 0.5, 0.75}},
+		// 与CSS相同，y坐标可以超出0-1
+		{"cubic-bezier(0.5, -1, 0.5, 2)", [3]float64{-0.1823, 0.5, 1.1823}},
+		{"cubic-bezier( 1e-1 , 0 , .9 , 1 )", [3]float64{0.2254, 0.5, 0.7746}},
+	} {
+		curve, err := parseEasing(tc.easing)
+		if err != nil {
+			t.Errorf("%q: %v", tc.easing, err)
+			continue
+		}
+		for i, p := range []float64{0.25, 0.5, 0.75} {
+			if got := curve(p); math.Abs(got-tc.want[i]) > 1e-3 {
+				t.Errorf("%q at %v = %.4f, want %.4f", tc.easing, p, got, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestParseEasingInvalid(t *testing.T) {
+	for _, easing := range []string{
+		"bounce",
+		"cubic-bezier",
+		"cubic-bezier()",
+		"cubic-bezier(0.1, 0, 0.9)",
+		"cubic-bezier(0.1, 0, 0.9, 1, 0)",
+		"cubic-bezier(0.1x, 0, 0.9, 1)",
+		"cubic-bezier(0.1, 0, 0.9, 1y)",
+		"cubic-bezier(0.1, , 0.9, 1)",
+		"cubic-bezier(0.1 0.2, 0, 0.9, 1)",
+		"cubic-bezier(nan, 0, 0.9, 1)",
+		"cubic-bezier(0.1, NaN, 0.9, 1)",
+		"cubic-bezier(0.1, inf, 0.9, 1)",
+		"cubic-bezier(0.1, 0, 0.9, -Inf)",
+		"cubic-bezier(-0.1, 0, 0.9, 1)",
+		"cubic-bezier(0.1, 0, 1.5, 1)",
+		"cubic-bezier(0.1, 0, 0.9, 1",
+	} {
+		if _, err := parseEasing(easing); err == nil {
+			t.Errorf("parseEasing(%q) succeeded", easing)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package ledcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// Keyframe interpolation modes, describing the transition to the next keyframe.
+// Any easing curve such as EASING_SINE or "cubic-bezier(...)" is accepted as well.
+const (
+	INTERPOLATION_LINEAR = "linear"
+	INTERPOLATION_STEP   = "step"
+	INTERPOLATION_EASE   = "ease"
+)
+
+// EffectKeyframe is a color at a point in time, in milliseconds from the start of the effect
+type EffectKeyframe struct {
+	Time          int           `json:"time"`
+	Color         KeyframeColor `json:"color"`
+	Interpolation string        `json:"interpolation,omitempty"`
+
+	curve func(float64) float64
+}
+
+// KeyframeColor is a keyframe color, written as [r, g, b] or as any string ParseColor accepts
+type KeyframeColor []int
+
+// UnmarshalJSON accepts an array of channel values or a color string
+func (kc *KeyframeColor) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var values []int
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("颜色必须是[r, g, b]或颜色字符串")
+		}
+		*kc = values
+		return nil
+	}
+	color, err := ParseColor(s)
+	if err != nil {
+		return err
+	}
+	*kc = KeyframeColor{color.Red, color.Green, color.Blue}
+	return nil
+}
+
+// ChannelKeyframe is a single channel value at a point in time
+type ChannelKeyframe struct {
+	Time          int    `json:"time"`
+	Value         int    `json:"value"`
+	Interpolation string `json:"interpolation,omitempty"`
+
+	curve func(float64) float64
+}
+
+// EffectTrack animates one channel independently, overriding that channel of the color keyframes
+type EffectTrack struct {
+	Channel   string             `json:"channel"`
+	Keyframes []*ChannelKeyframe `json:"keyframes"`
+}
+
+// EffectDefinition is a declarative effect loaded from JSON, for example:
+//
+//	{
+//	  "name": "sunrise",
+//	  "repeat": 0,
+//	  "keyframes": [
+//	    {"time": 0, "color": [0, 0, 0]},
+//	    {"time": 1000, "color": "#ff8000", "interpolation": "step"},
+//	    {"time": 1200, "color": "purple", "interpolation": "sine"},
+//	    {"time": 1500, "color": [0, 0, 0]}
+//	  ],
+//	  "tracks": [
+//	    {"channel": "blue", "keyframes": [{"time": 0, "value": 0}, {"time": 1500, "value": 255}]}
+//	  ]
+//	}
+//
+// Colors are [r, g, b] arrays, hex strings or CSS color names. Times are milliseconds.
+// "color_space" selects how color keyframes are interpolated, see COLOR_SPACE_*; tracks are
+// always interpolated per channel. Repeat is the number of plays, 0 loops until stopped.
+// Duration defaults to the time of the last keyframe. With "tempo": true the times are
+// nominal at 120 BPM (500ms per beat) and follow the tempo clock.
+type EffectDefinition struct {
+	Name       string            `json:"name"`
+	Repeat     int               `json:"repeat"`
+	Duration   int               `json:"duration,omitempty"`
+	Tempo      bool              `json:"tempo,omitempty"`
+	ColorSpace string            `json:"color_space,omitempty"`
+	Keyframes  []*EffectKeyframe `json:"keyframes,omitempty"`
+	Tracks     []*EffectTrack    `json:"tracks,omitempty"`
+
+	// 按通道展开后的关键帧和颜色空间插值函数，由validate生成
+	channels [3][]*ChannelKeyframe
+	tracked  [3]bool
+	mix      func(from, to Color, progress float64) Color
+}
+
+// ParseEffect parses and validates a JSON effect definition
+func ParseEffect(data []byte) (*EffectDefinition, error) {
+	def := &EffectDefinition{}
+	if err := json.Unmarshal(data, def); err != nil {
+		return nil, fmt.Errorf("解析灯效文件失败: %v", err)
+	}
+	if err := def.validate(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// LoadEffectFile reads and validates a JSON effect definition from a file
+func LoadEffectFile(path string) (*EffectDefinition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取灯效文件失败: %v", err)
+	}
+	return ParseEffect(data)
+}
+
+// validate checks the definition and expands it into per-channel keyframes
+func (d *EffectDefinition) validate() error {
+	if len(d.Keyframes) == 0 && len(d.Tracks) == 0 {
+		return fmt.Errorf("灯效 %q 没有关键帧", d.Name)
+	}
+	if d.Repeat < 0 {
+		return fmt.Errorf("灯效 %q 的repeat不能为负数", d.Name)
+	}
+
+	var channels [3][]*ChannelKeyframe
+	var tracked [3]bool
+	for i, kf := range d.Keyframes {
+		if kf == nil {
+			return fmt.Errorf("第%d个关键帧为空", i+1)
+		}
+		if len(kf.Color) != 3 {
+			return fmt.Errorf("第%d个关键帧的颜色必须是[r, g, b]", i+1)
+		}
+		curve, err := keyframeCurve(kf.Interpolation)
+		if err != nil {
+			return err
+		}
+		kf.curve = curve
+		for channel, value := range kf.Color {
+			channels[channel] = append(channels[channel], &ChannelKeyframe{
+				Time:          kf.Time,
+				Value:         value,
+				Interpolation: kf.Interpolation,
+				curve:         curve,
+			})
+		}
+	}
+
+	for i, track := range d.Tracks {
+		if track == nil {
+			return fmt.Errorf("第%d个轨道为空", i+1)
+		}
+		channel, ok := channelByName(track.Channel)
+		if !ok {
+			return fmt.Errorf("无效的通道: %q", track.Channel)
+		}
+		if len(track.Keyframes) == 0 {
+			return fmt.Errorf("通道 %s 的轨道没有关键帧", track.Channel)
+		}
+		for j, kf := range track.Keyframes {
+			if kf == nil {
+				return fmt.Errorf("通道 %s 的第%d个关键帧为空", track.Channel, j+1)
+			}
+		}
+		// 单独的通道轨道覆盖颜色关键帧中的该通道
+		channels[channel] = track.Keyframes
+		tracked[channel] = true
+	}
+
+	last := 0
+	for channel, keyframes := range channels {
+		prev := -1
+		for i, kf := range keyframes {
+			if kf.Time < 0 || kf.Time < prev {
+				return fmt.Errorf("通道%d第%d个关键帧的时间必须非负且递增", channel, i+1)
+			}
+			if kf.Value < 0 || kf.Value > 255 {
+				return fmt.Errorf("通道%d第%d个关键帧的值必须在0-255范围内", channel, i+1)
+			}
+			curve, err := keyframeCurve(kf.Interpolation)
+			if err != nil {
+				return err
+			}
+			kf.curve = curve
+			prev = kf.Time
+		}
+		if prev > last {
+			last = prev
+		}
+	}
+
+	if d.Duration == 0 {
+		d.Duration = last
+	}
+	if d.Duration <= 0 {
+		return fmt.Errorf("灯效 %q 的时长必须大于0", d.Name)
+	}
+	if d.Duration < last {
+		return fmt.Errorf("灯效 %q 的时长小于最后一个关键帧的时间", d.Name)
+	}
+
+	d.mix = nil
+	if d.ColorSpace != "" {
+		interp, err := NewInterpolation("", d.ColorSpace)
+		if err != nil {
+			return err
+		}
+		d.mix = interp.mix
+	}
+
+	d.channels = channels
+	d.tracked = tracked
+	return nil
+}
+
+// keyframeCurve resolves a keyframe interpolation mode to its easing curve, nil for step
+func keyframeCurve(interpolation string) (func(float64) float64, error) {
+	switch interpolation {
+	case INTERPOLATION_STEP:
+		return nil, nil
+	case INTERPOLATION_EASE:
+		return easeInOut, nil
+	}
+	curve, err := parseEasing(interpolation)
+	if err != nil {
+		return nil, fmt.Errorf("无效的插值方式: %q", interpolation)
+	}
+	return curve, nil
+}
+
+// channelByName maps a channel name used in effect files to its index
+func channelByName(name string) (int, bool) {
+	switch name {
+	case LED_COLOR_RED:
+		return CHANNEL_RED, true
+	case LED_COLOR_GREEN:
+		return CHANNEL_GREEN, true
+	case LED_COLOR_BLUE:
+		return CHANNEL_BLUE, true
+	}
+	return 0, false
+}
+
+// ColorAt returns the color of a single play of the effect at t
+func (d *EffectDefinition) ColorAt(t time.Duration) Color {
+	ms := float64(t) / float64(time.Millisecond)
+	var values [3]int
+	if d.mix != nil && len(d.Keyframes) > 0 {
+		// 颜色关键帧在指定的颜色空间中整体插值，轨道仍然覆盖各自的通道
+		color := sampleKeyframes(d.Keyframes, ms, d.mix)
+		values = [3]int{color.Red, color.Green, color.Blue}
+	}
+	for channel, keyframes := range d.channels {
+		if d.mix == nil || d.tracked[channel] {
+			values[channel] = sampleChannel(keyframes, ms)
+		}
+	}
+	return Color{values[0], values[1], values[2]}
+}
+
+// sampleKeyframes evaluates color keyframes at a time in milliseconds, mixing colors with mix
+func sampleKeyframes(keyframes []*EffectKeyframe, ms float64, mix func(from, to Color, progress float64) Color) Color {
+	color := func(kf *EffectKeyframe) Color {
+		return Color{kf.Color[0], kf.Color[1], kf.Color[2]}
+	}
+	if ms <= float64(keyframes[0].Time) {
+		return color(keyframes[0])
+	}
+
+	for i := 0; i < len(keyframes)-1; i++ {
+		from, to := keyframes[i], keyframes[i+1]
+		if ms >= float64(to.Time) {
+			continue
+		}
+		if from.curve == nil {
+			return color(from)
+		}
+		progress := (ms - float64(from.Time)) / float64(to.Time-from.Time)
+		return mix(color(from), color(to), from.curve(progress))
+	}
+	return color(keyframes[len(keyframes)-1])
+}
+
+// sampleChannel evaluates channel keyframes at a time in milliseconds
+func sampleChannel(keyframes []*ChannelKeyframe, ms float64) int {
+	if len(keyframes) == 0 {
+		return 0
+	}
+	if ms <= float64(keyframes[0].Time) {
+		return keyframes[0].Value
+	}
+
+	for i := 0; i < len(keyframes)-1; i++ {
+		from, to := keyframes[i], keyframes[i+1]
+		if ms >= float64(to.Time) {
+			continue
+		}
+
+		if from.curve == nil {
+			return from.Value
+		}
+		// 回弹曲线的进度可能超出[0, 1]
+		progress := from.curve((ms - float64(from.Time)) / float64(to.Time-from.Time))
+		return clampChannel(from.Value + int(progress*float64(to.Value-from.Value)))
+	}
+	return keyframes[len(keyframes)-1].Value
+}
+
+// Frame returns the color at t, looping the definition Repeat times
+func (d *EffectDefinition) Frame(t time.Duration) (Color, time.Duration, bool) {
+	duration := time.Duration(d.Duration) * time.Millisecond
+	if d.Repeat > 0 && t >= time.Duration(d.Repeat)*duration {
+		return d.ColorAt(duration), 0, true
+	}
+	return d.ColorAt(t % duration), 0, false
+}
+
+// PlayEffect plays a loaded effect definition as EFFECT_CUSTOM
+func (c *Controller) PlayEffect(def *EffectDefinition) error {
+	if def == nil {
+		return fmt.Errorf("灯效定义为空")
+	}
+	if !c.IsLEDEnabled() {
+		return DecisionError(DECISION_DISABLED, EFFECT_CUSTOM)
+	}
+	log.Printf("PlayEffect: 开始播放灯效 %q", def.Name)
+	decision := c.startTimedEffect(&effectRequest{
+		effectType: EFFECT_CUSTOM,
+		effect: func(ctx context.Context) error {
+			if def.Tempo {
+				return c.playPattern(ctx, c.tempo.synced(def))
+			}
+			return c.playPattern(ctx, def)
+		},
+		persistent: def.Repeat == 0,
+	})
+	return DecisionError(decision, EFFECT_CUSTOM)
+}
+
+// PlayEffectFile loads and plays a JSON effect file
+func (c *Controller) PlayEffectFile(path string) error {
+	def, err := LoadEffectFile(path)
+	if err != nil {
+		return err
+	}
+	return c.PlayEffect(def)
+}
+
+// PlayEffectJSON parses and plays a JSON effect definition
+func (c *Controller) PlayEffectJSON(data string) error {
+	def, err := ParseEffect([]byte(data))
+	if err != nil {
+		return err
+	}
+	return c.PlayEffect(def)
+}
@@ -0,0 +1,115 @@
+package ledcontroller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEffectTrackOvershootClamped(t *testing.T) {
+	def, err := ParseEffect([]byte(`{
+		"name": "overshoot",
+		"repeat": 1,
+		"tracks": [
+			{"channel": "red", "keyframes": [
+				{"time": 0, "value": 20, "interpolation": "cubic-bezier(0.3, -0.6, 0.7, 1.6)"},
+				{"time": 1000, "value": 235}
+			]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, high := 255, 0
+	for ms := 0; ms <= 1000; ms += 10 {
+		red := def.ColorAt(time.Duration(ms) * time.Millisecond).Red
+		if red < low {
+			low = red
+		}
+		if red > high {
+			high = red
+		}
+	}
+	if low != 0 || high != 255 {
+		t.Errorf("track ranged from %d to %d, want the overshoot clamped to 0 and 255", low, high)
+	}
+}
+
+func TestParseEffectInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"not json", `{"name": "x", "keyframes": [`},
+		{"no keyframes", `{"name": "x"}`},
+		{"negative repeat", `{"name": "x", "repeat": -1, "keyframes": [{"time": 0, "color": "red"}, {"time": 100, "color": "blue"}]}`},
+		{"null keyframe", `{"name": "x", "keyframes": [null]}`},
+		{"null track", `{"name": "x", "tracks": [null]}`},
+		{"null track keyframe", `{"name": "x", "tracks": [{"channel": "red", "keyframes": [null]}]}`},
+		{"two channels", `{"name": "x", "keyframes": [{"time": 0, "color": [1, 2]}, {"time": 100, "color": [1, 2]}]}`},
+		{"bad color", `{"name": "x", "keyframes": [{"time": 0, "color": "nocolor"}, {"time": 100, "color": "red"}]}`},
+		{"bad interpolation", `{"name": "x", "keyframes": [{"time": 0, "color": "red", "interpolation": "wobble"}, {"time": 100, "color": "red"}]}`},
+		{"bad channel", `{"name": "x", "tracks": [{"channel": "white", "keyframes": [{"time": 100, "value": 1}]}]}`},
+		{"empty track", `{"name": "x", "tracks": [{"channel": "red", "keyframes": []}]}`},
+		{"negative time", `{"name": "x", "keyframes": [{"time": -10, "color": "red"}, {"time": 100, "color": "red"}]}`},
+		{"decreasing time", `{"name": "x", "keyframes": [{"time": 100, "color": "red"}, {"time": 50, "color": "red"}]}`},
+		{"value too large", `{"name": "x", "tracks": [{"channel": "blue", "keyframes": [{"time": 100, "value": 256}]}]}`},
+		{"negative value", `{"name": "x", "keyframes": [{"time": 0, "color": [0, -1, 0]}, {"time": 100, "color": "red"}]}`},
+		{"zero duration", `{"name": "x", "keyframes": [{"time": 0, "color": "red"}]}`},
+		{"duration before last keyframe", `{"name": "x", "duration": 50, "keyframes": [{"time": 0, "color": "red"}, {"time": 100, "color": "blue"}]}`},
+		{"bad color space", `{"name": "x", "color_space": "cmyk", "keyframes": [{"time": 0, "color": "red"}, {"time": 100, "color": "blue"}]}`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseEffect([]byte(tt.json)); err == nil {
+			t.Errorf("%s: ParseEffect accepted %s", tt.name, tt.json)
+		}
+	}
+}
+
+func TestParseEffectValid(t *testing.T) {
+	def, err := ParseEffect([]byte(`{
+		"name": "sunrise",
+		"color_space": "hsv",
+		"keyframes": [
+			{"time": 0, "color": [0, 0, 0], "interpolation": "step"},
+			{"time": 1000, "color": "#ff8000"},
+			{"time": 1500, "color": "red"}
+		],
+		"tracks": [
+			{"channel": "blue", "keyframes": [{"time": 0, "value": 0}, {"time": 2000, "value": 200}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第一段用step保持关闭，第二段在HSV中插值，蓝色由轨道单独控制。
+	// 时长默认为最后一个关键帧的时间，包括轨道
+	if def.Duration != 2000 {
+		t.Errorf("duration = %d, want 2000", def.Duration)
+	}
+	tests := []struct {
+		at   time.Duration
+		want Color
+	}{
+		{0, Color{0, 0, 0}},
+		{500 * time.Millisecond, Color{0, 0, 50}},
+		{1200 * time.Millisecond, Color{255, 77, 120}},
+		{2000 * time.Millisecond, Color{255, 0, 200}},
+	}
+	for _, tt := range tests {
+		if color := def.ColorAt(tt.at); color != tt.want {
+			t.Errorf("ColorAt(%v) = %v, want %v", tt.at, color, tt.want)
+		}
+	}
+}
+
+func TestPlayEffectDisabled(t *testing.T) {
+	c := NewController(&ControllerOptions{Backend: NewSimBackend()})
+	c.SetLEDEnabled(false)
+	err := c.PlayEffectJSON(`{"name": "x", "keyframes": [{"time": 0, "color": "red"}, {"time": 100, "color": "blue"}]}`)
+	if err == nil || err.Error() != "LED已关闭" {
+		t.Errorf("PlayEffectJSON with the LED disabled returned %v, want LED已关闭", err)
+	}
+	if c.IsEffectActive() {
+		t.Error("effect started with the LED disabled")
+	}
+}
@@ -0,0 +1,58 @@
+package ledcontroller
+
+import "strings"
+
+// effectNames are the names of the built-in effect types, as used by command line tools
+var effectNames = map[int]string{
+	EFFECT_BOOTUP:               "bootup",
+	EFFECT_NOTIFICATION:         "notification",
+	EFFECT_CALL:                 "call",
+	EFFECT_CHARGING_LOW:         "charging-low",
+	EFFECT_CHARGING_HIGH:        "charging-high",
+	EFFECT_CHARGING_COMPLETE:    "charging-complete",
+	EFFECT_WIFI_CONNECTING:      "wifi-connecting",
+	EFFECT_WIFI_CONNECTED:       "wifi-connected",
+	EFFECT_WIFI_FAILED:          "wifi-failed",
+	EFFECT_BLUETOOTH_CONNECTING: "bluetooth-connecting",
+	EFFECT_BLUETOOTH_CONNECTED:  "bluetooth-connected",
+	EFFECT_BLUETOOTH_FAILED:     "bluetooth-failed",
+	EFFECT_CAMERA_FOCUS:         "camera-focus",
+	EFFECT_CAMERA_CAPTURE:       "camera-capture",
+	EFFECT_CAMERA_SAVE:          "camera-save",
+	EFFECT_PARTY:                "party",
+	EFFECT_MUSIC:                "music",
+	EFFECT_CUSTOM:               "custom",
+	EFFECT_MUSIC_REACTIVE:       "music-reactive",
+}
+
+// EffectName returns the name of an effect type such as "wifi-connecting", "none" for EFFECT_NONE
+// and "" for an unknown type
+func EffectName(effectType int) string {
+	if effectType == EFFECT_NONE {
+		return "none"
+	}
+	return effectNames[effectType]
+}
+
+// EffectTypeByName returns the effect type with the given name, EFFECT_NONE if there is none.
+// Case is ignored and underscores may be used instead of dashes.
+func EffectTypeByName(name string) int {
+	name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+	for effectType, effectName := range effectNames {
+		if effectName == name {
+			return effectType
+		}
+	}
+	return EFFECT_NONE
+}
+
+// IsBuiltinEffect returns whether an effect type can be started with RequestEffect
+func IsBuiltinEffect(effectType int) bool {
+	_, ok := builtinEffects[effectType]
+	return ok
+}
+
+// IsPersistentEffect returns whether an effect type keeps running until it is stopped
+func IsPersistentEffect(effectType int) bool {
+	return persistentEffects[effectType]
+}
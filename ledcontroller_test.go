@@ -0,0 +1,97 @@
+package ledcontroller
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDisableWhileWriteWaits(t *testing.T) {
+	sim := NewSimBackend()
+	c := NewController(&ControllerOptions{Backend: sim})
+
+	// 写入已通过总开关检查，正在等待writeMutex
+	c.writeMutex.Lock()
+	done := make(chan error, 1)
+	go func() { done <- c.setColor(Color{255, 255, 255}) }()
+	time.Sleep(10 * time.Millisecond)
+	c.writeMutex.Unlock()
+	c.SetLEDEnabled(false)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if color := sim.Color(); *color != ColorOff {
+		t.Fatalf("LED shows %v after SetLEDEnabled(false), want off", *color)
+	}
+
+	// 关灯在等待中的写入之前完成
+	c.SetLEDEnabled(true)
+	c.writeMutex.Lock()
+	go func() { done <- c.setColor(Color{255, 255, 255}) }()
+	time.Sleep(10 * time.Millisecond)
+	c.mutex.Lock()
+	c.ledEnabled = false
+	c.mutex.Unlock()
+	c.writeMutex.Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if color := sim.Color(); *color != ColorOff {
+		t.Fatalf("write that waited across the switch-off showed %v", *color)
+	}
+}
+
+func TestDisableLogsWriteError(t *testing.T) {
+	sim := NewSimBackend()
+	c := NewController(&ControllerOptions{Backend: sim})
+	c.StartTrace()
+	sim.SetPermissionDenied(true)
+	c.SetLEDEnabled(false)
+	// 写入失败时不记录关灯
+	if trace := c.StopTrace(); len(trace.Events) != 0 {
+		t.Errorf("failed switch-off recorded %d trace events", len(trace.Events))
+	}
+	if c.IsLEDEnabled() {
+		t.Error("LED still enabled after SetLEDEnabled(false)")
+	}
+}
+
+func TestNoWriteAfterStop(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	defer c.StopAllEffects()
+
+	for i := 0; i < 50; i++ {
+		// 启动和停止同时进行，两者谁先都可以
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.StartEffect(EFFECT_WIFI_CONNECTING)
+		}()
+		go func() {
+			defer wg.Done()
+			c.StopCurrentEffect()
+		}()
+		wg.Wait()
+		clock.Advance(100 * time.Millisecond)
+		c.StopCurrentEffect()
+
+		// 停止返回之后效果不再写入
+		writes := sim.WriteCount()
+		for j := 0; j < 5; j++ {
+			time.Sleep(time.Millisecond)
+			clock.Advance(time.Second)
+		}
+		if n := sim.WriteCount(); n != writes {
+			t.Fatalf("iteration %d: %d writes after StopCurrentEffect returned", i, n-writes)
+		}
+		if color := sim.Color(); *color != ColorOff {
+			t.Fatalf("iteration %d: LED shows %v after StopCurrentEffect", i, *color)
+		}
+		if c.IsEffectActive() {
+			t.Fatalf("iteration %d: effect still active after StopCurrentEffect", i)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ledcontroller
+
+// Reasons passed to EffectListener.OnEffectFinished
+const (
+	FINISH_REASON_COMPLETED = 1 // 效果自然播放结束
+	FINISH_REASON_STOPPED   = 2 // 被StopCurrentEffect等调用停止
+	FINISH_REASON_PREEMPTED = 3 // 被优先级不低于它的效果打断
+	FINISH_REASON_ERROR     = 4 // 写入LED出错后退出
+)
+
+// EffectListener receives effect lifecycle events, e.g. to update the app UI without polling.
+// Events are delivered in order on a separate goroutine, so the listener may call back into the controller.
+type EffectListener interface {
+	// OnEffectStarted is called when an effect starts or a background effect resumes
+	OnEffectStarted(effectType int)
+	// OnEffectFinished is called when an effect ends, reason is one of FINISH_REASON_*
+	OnEffectFinished(effectType int, reason int)
+	// OnError is called when an effect fails, before OnEffectFinished
+	OnError(effectType int, message string)
+}
+
+// SetEffectListener registers the listener for effect lifecycle events, nil removes it
+func (c *Controller) SetEffectListener(listener EffectListener) {
+	c.listenerMutex.Lock()
+	defer c.listenerMutex.Unlock()
+	c.listener = listener
+	if listener == nil {
+		c.events = nil
+	}
+}
+
+// notify queues a listener call, must not be called with mutex held
+func (c *Controller) notify(event func(listener EffectListener)) {
+	c.listenerMutex.Lock()
+	defer c.listenerMutex.Unlock()
+	if c.listener == nil {
+		return
+	}
+	c.events = append(c.events, event)
+	if !c.dispatching {
+		c.dispatching = true
+		go c.dispatchEvents()
+	}
+}
+
+// dispatchEvents delivers queued events one at a time until the queue is empty
+func (c *Controller) dispatchEvents() {
+	for {
+		c.listenerMutex.Lock()
+		if len(c.events) == 0 || c.listener == nil {
+			c.events = nil
+			c.dispatching = false
+			c.listenerMutex.Unlock()
+			return
+		}
+		event := c.events[0]
+		c.events = c.events[1:]
+		listener := c.listener
+		c.listenerMutex.Unlock()
+
+		event(listener)
+	}
+}
+
+// notifyStarted reports that an effect has started
+func (c *Controller) notifyStarted(effectType int) {
+	c.notify(func(listener EffectListener) {
+		listener.OnEffectStarted(effectType)
+	})
+}
+
+// notifyFinished reports that an effect has ended, with the error that ended it if any
+func (c *Controller) notifyFinished(effectType, reason int, err error) {
+	c.notify(func(listener EffectListener) {
+		if err != nil {
+			listener.OnError(effectType, err.Error())
+		}
+		listener.OnEffectFinished(effectType, reason)
+	})
+}
@@ -0,0 +1,245 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ColorWriter is implemented by backends that can set all channels in a single write,
+// avoiding the in-between colors of writing red, green and blue one by one
+type ColorWriter interface {
+	WriteColor(color Color) error
+}
+
+// MulticolorBackend drives a led-class-multicolor device through multi_intensity
+type MulticolorBackend struct {
+	dir           string
+	maxBrightness int
+	triggers      map[string]bool
+
+	// multi_index中每个位置对应的通道，其它颜色（例如white）为-1
+	index []int
+
+	// 保持打开的multi_intensity和brightness文件
+	intensity  *attrFile
+	brightness *attrFile
+	counters   writeCounters
+
+	mu sync.Mutex
+	// 最近写入的0-255颜色值
+	current [3]int
+	// 共享的brightness是否已设置为最大值
+	brightnessSet bool
+}
+
+// NewMulticolorBackend creates a backend for the multicolor LED device in dir
+func NewMulticolorBackend(dir string) (*MulticolorBackend, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "multi_index"))
+	if err != nil {
+		return nil, fmt.Errorf("读取multi_index失败: %v", err)
+	}
+
+	b := &MulticolorBackend{
+		dir:           dir,
+		maxBrightness: readMaxBrightness(dir),
+		triggers:      readTriggers(dir),
+	}
+	b.intensity = newAttrFile(filepath.Join(dir, "multi_intensity"), &b.counters)
+	b.brightness = newAttrFile(filepath.Join(dir, "brightness"), &b.counters)
+
+	var found [3]bool
+	for _, name := range strings.Fields(string(data)) {
+		channel := -1
+		switch name {
+		case LED_COLOR_RED:
+			channel = CHANNEL_RED
+		case LED_COLOR_GREEN:
+			channel = CHANNEL_GREEN
+		case LED_COLOR_BLUE:
+			channel = CHANNEL_BLUE
+		}
+		if channel >= 0 {
+			found[channel] = true
+		}
+		b.index = append(b.index, channel)
+	}
+	if !found[CHANNEL_RED] || !found[CHANNEL_GREEN] || !found[CHANNEL_BLUE] {
+		return nil, fmt.Errorf("多色LED缺少红绿蓝通道: %s", strings.TrimSpace(string(data)))
+	}
+	return b, nil
+}
+
+// WriteColor writes all three intensities to multi_intensity in one write
+func (b *MulticolorBackend) WriteColor(color Color) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.writeLocked([3]int{color.Red, color.Green, color.Blue})
+}
+
+// WriteChannel updates one channel and rewrites multi_intensity
+func (b *MulticolorBackend) WriteChannel(channel int, value int) error {
+	if channel < CHANNEL_RED || channel > CHANNEL_BLUE {
+		return fmt.Errorf("无效的通道: %d", channel)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	values := b.current
+	values[channel] = value
+	return b.writeLocked(values)
+}
+
+// writeLocked writes the intensities in multi_index order, b.mu must be held
+func (b *MulticolorBackend) writeLocked(values [3]int) error {
+	if err := b.intensity.write(b.intensityString(values)); err != nil {
+		return err
+	}
+	b.current = values
+
+	// 颜色完全由multi_intensity决定，brightness只需设置一次最大值
+	if !b.brightnessSet {
+		if err := b.brightness.write(strconv.Itoa(b.maxBrightness)); err != nil {
+			return err
+		}
+		b.brightnessSet = true
+	}
+	return nil
+}
+
+// intensityString formats the values in multi_index order, scaled to max_brightness
+func (b *MulticolorBackend) intensityString(values [3]int) string {
+	fields := make([]string, len(b.index))
+	for i, channel := range b.index {
+		raw := 0
+		if channel >= 0 {
+			raw = scaleToDevice(values[channel], b.maxBrightness)
+		}
+		fields[i] = strconv.Itoa(raw)
+	}
+	return strings.Join(fields, " ")
+}
+
+// ReadChannel reads a channel from multi_intensity, scaled back to 0-255
+func (b *MulticolorBackend) ReadChannel(channel int) (int, error) {
+	if channel < CHANNEL_RED || channel > CHANNEL_BLUE {
+		return 0, fmt.Errorf("无效的通道: %d", channel)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(b.dir, "multi_intensity"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	for i, c := range b.index {
+		if c != channel || i >= len(fields) {
+			continue
+		}
+		raw, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return 0, err
+		}
+		return scaleFromDevice(raw, b.maxBrightness), nil
+	}
+	return 0, fmt.Errorf("multi_intensity格式错误: %s", strings.TrimSpace(string(data)))
+}
+
+// Capabilities reports the multicolor backend capabilities
+func (b *MulticolorBackend) Capabilities() *Capabilities {
+	return &Capabilities{
+		Channels:      3,
+		MaxBrightness: b.maxBrightness,
+		Readable:      true,
+		AtomicColor:   true,
+	}
+}
+
+// HasTrigger reports whether the device supports the named trigger
+func (b *MulticolorBackend) HasTrigger(name string) bool {
+	return b.triggers[name]
+}
+
+// StartBlink blinks the color with the timer trigger
+func (b *MulticolorBackend) StartBlink(color Color, onMs, offMs int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.intensity.write(b.intensityString([3]int{color.Red, color.Green, color.Blue})); err != nil {
+		return err
+	}
+	if err := writeAttr(b.dir, "trigger", TRIGGER_TIMER); err != nil {
+		return fmt.Errorf("设置timer触发器失败: %v", err)
+	}
+	if err := writeAttr(b.dir, "delay_on", strconv.Itoa(onMs)); err != nil {
+		return fmt.Errorf("设置delay_on失败: %v", err)
+	}
+	if err := writeAttr(b.dir, "delay_off", strconv.Itoa(offMs)); err != nil {
+		return fmt.Errorf("设置delay_off失败: %v", err)
+	}
+	b.brightness.invalidate()
+	return b.brightness.write(strconv.Itoa(b.maxBrightness))
+}
+
+// StartBreathe fades the color in and out with the pattern trigger, repeat -1 means forever
+func (b *MulticolorBackend) StartBreathe(color Color, periodMs, repeat int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	half := periodMs / 2
+	if err := b.intensity.write(b.intensityString([3]int{color.Red, color.Green, color.Blue})); err != nil {
+		return err
+	}
+	if err := writeAttr(b.dir, "trigger", TRIGGER_PATTERN); err != nil {
+		return fmt.Errorf("设置pattern触发器失败: %v", err)
+	}
+	// 颜色由multi_intensity决定，pattern只控制共享的brightness
+	if err := writeAttr(b.dir, "pattern", fmt.Sprintf("0 %d %d %d", half, b.maxBrightness, half)); err != nil {
+		return fmt.Errorf("设置pattern失败: %v", err)
+	}
+	if err := writeAttr(b.dir, "repeat", strconv.Itoa(repeat)); err != nil {
+		return fmt.Errorf("设置repeat失败: %v", err)
+	}
+	b.brightness.invalidate()
+	return nil
+}
+
+// ClearTrigger gives control of the LED back to multi_intensity writes
+func (b *MulticolorBackend) ClearTrigger() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.triggers) > 0 {
+		if err := writeAttr(b.dir, "trigger", TRIGGER_NONE); err != nil {
+			return fmt.Errorf("清除触发器失败: %v", err)
+		}
+	}
+	// 清除触发器后内核会关闭LED，下次写入时重新设置brightness
+	b.brightnessSet = false
+	b.brightness.invalidate()
+	return b.writeLocked([3]int{})
+}
+
+// WriteStats returns the attribute writes issued and skipped so far
+func (b *MulticolorBackend) WriteStats() *WriteStats {
+	return b.counters.snapshot()
+}
+
+// ResetWriteStats sets the write counters back to zero
+func (b *MulticolorBackend) ResetWriteStats() {
+	b.counters.reset()
+}
+
+// Close releases the open attribute files, later writes reopen them
+func (b *MulticolorBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.intensity.close()
+	if berr := b.brightness.close(); err == nil {
+		err = berr
+	}
+	b.brightnessSet = false
+	return err
+}
@@ -0,0 +1,148 @@
+package ledcontroller
+
+import (
+	"context"
+	"fmt"
+)
+
+// Arbitration decisions returned by RequestEffect
+const (
+	DECISION_INVALID    = 0 // 未知的效果类型
+	DECISION_STARTED    = 1 // 没有活动效果，直接启动
+	DECISION_PREEMPTED  = 2 // 抢占了优先级不高于它的当前效果
+	DECISION_QUEUED     = 3 // 优先级较低的持续效果，等当前效果结束后启动
+	DECISION_REJECTED   = 4 // 优先级较低的一次性效果，被拒绝
+	DECISION_DISABLED   = 5 // LED总开关已关闭
+	DECISION_SUPPRESSED = 6 // 勿扰模式屏蔽了该效果
+	DECISION_DIMMED     = 7 // 已启动，勿扰模式降低了亮度
+	DECISION_SUBTLE     = 8 // 已启动，勿扰模式换成了柔和变体
+)
+
+// Default effect priorities, higher wins
+const (
+	PRIORITY_CALL         = 100
+	PRIORITY_BOOTUP       = 90
+	PRIORITY_LOW_BATTERY  = 80
+	PRIORITY_NOTIFICATION = 60
+	PRIORITY_CAMERA       = 50
+	PRIORITY_CONNECTIVITY = 40
+	PRIORITY_AMBIENT      = 30
+	PRIORITY_CHARGING     = 20
+)
+
+// defaultPriorities is the built-in priority of each effect type
+var defaultPriorities = map[int]int{
+	EFFECT_CALL:                 PRIORITY_CALL,
+	EFFECT_BOOTUP:               PRIORITY_BOOTUP,
+	EFFECT_CHARGING_LOW:         PRIORITY_LOW_BATTERY,
+	EFFECT_NOTIFICATION:         PRIORITY_NOTIFICATION,
+	EFFECT_CAMERA_FOCUS:         PRIORITY_CAMERA,
+	EFFECT_CAMERA_CAPTURE:       PRIORITY_CAMERA,
+	EFFECT_CAMERA_SAVE:          PRIORITY_CAMERA,
+	EFFECT_WIFI_CONNECTING:      PRIORITY_CONNECTIVITY,
+	EFFECT_WIFI_CONNECTED:       PRIORITY_CONNECTIVITY,
+	EFFECT_WIFI_FAILED:          PRIORITY_CONNECTIVITY,
+	EFFECT_BLUETOOTH_CONNECTING: PRIORITY_CONNECTIVITY,
+	EFFECT_BLUETOOTH_CONNECTED:  PRIORITY_CONNECTIVITY,
+	EFFECT_BLUETOOTH_FAILED:     PRIORITY_CONNECTIVITY,
+	EFFECT_PARTY:                PRIORITY_AMBIENT,
+	EFFECT_MUSIC:                PRIORITY_AMBIENT,
+	EFFECT_CUSTOM:               PRIORITY_AMBIENT,
+	EFFECT_MUSIC_REACTIVE:       PRIORITY_AMBIENT,
+	EFFECT_CHARGING_HIGH:        PRIORITY_CHARGING,
+	EFFECT_CHARGING_COMPLETE:    PRIORITY_CHARGING,
+}
+
+// persistentEffects are the effects that keep running until stopped
+var persistentEffects = map[int]bool{
+	EFFECT_NOTIFICATION:         true,
+	EFFECT_CALL:                 true,
+	EFFECT_CHARGING_LOW:         true,
+	EFFECT_CHARGING_HIGH:        true,
+	EFFECT_CHARGING_COMPLETE:    true,
+	EFFECT_WIFI_CONNECTING:      true,
+	EFFECT_BLUETOOTH_CONNECTING: true,
+	EFFECT_PARTY:                true,
+	EFFECT_MUSIC:                true,
+	EFFECT_MUSIC_REACTIVE:       true,
+}
+
+// copyPriorities returns a copy of a priority table
+func copyPriorities(priorities map[int]int) map[int]int {
+	result := make(map[int]int, len(priorities))
+	for effectType, priority := range priorities {
+		result[effectType] = priority
+	}
+	return result
+}
+
+// SetEffectPriority overrides the priority of an effect type
+func (c *Controller) SetEffectPriority(effectType, priority int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.effectPriorities[effectType] = priority
+}
+
+// GetEffectPriority returns the priority of an effect type
+func (c *Controller) GetEffectPriority(effectType int) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.effectPriorities[effectType]
+}
+
+// ResetEffectPriorities restores the default priorities
+func (c *Controller) ResetEffectPriorities() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.effectPriorities = copyPriorities(defaultPriorities)
+}
+
+// RequestEffect starts the specified effect subject to priority arbitration and returns the decision
+func (c *Controller) RequestEffect(effectType int) int {
+	if !c.IsLEDEnabled() {
+		return DECISION_DISABLED
+	}
+	effect, ok := builtinEffects[effectType]
+	if !ok {
+		return DECISION_INVALID
+	}
+	return c.startTimedEffect(&effectRequest{
+		effectType: effectType,
+		effect: func(ctx context.Context) error {
+			return effect(c, ctx)
+		},
+		persistent: persistentEffects[effectType],
+	})
+}
+
+// arbitrate decides whether a request may replace the running effect, mutex must be held.
+// A lower-priority persistent request is queued, a lower-priority one-shot request is rejected.
+func (c *Controller) arbitrate(req *effectRequest) int {
+	if !c.effectActive || c.currentEffectType == EFFECT_NONE {
+		return DECISION_STARTED
+	}
+	if c.effectPriorities[req.effectType] >= c.effectPriorities[c.currentEffectType] {
+		return DECISION_PREEMPTED
+	}
+	if req.persistent {
+		c.pushBackgroundEffect(req)
+		return DECISION_QUEUED
+	}
+	return DECISION_REJECTED
+}
+
+// DecisionError converts an arbitration decision into the error returned by the effect functions,
+// nil when the effect was started or queued
+func DecisionError(decision, effectType int) error {
+	switch decision {
+	case DECISION_STARTED, DECISION_PREEMPTED, DECISION_QUEUED, DECISION_DIMMED, DECISION_SUBTLE:
+		return nil
+	case DECISION_REJECTED:
+		return fmt.Errorf("效果%d的优先级低于当前效果，已拒绝", effectType)
+	case DECISION_DISABLED:
+		return fmt.Errorf("LED已关闭")
+	case DECISION_SUPPRESSED:
+		return fmt.Errorf("勿扰模式已屏蔽效果%d", effectType)
+	}
+	return fmt.Errorf("无效的效果类型: %d", effectType)
+}
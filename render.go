@@ -0,0 +1,255 @@
+package ledcontroller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Frame rate limits in frames per second
+const (
+	DEFAULT_FRAME_RATE = 100
+	MIN_FRAME_RATE     = 1
+	MAX_FRAME_RATE     = 250
+)
+
+// renderJob is a pattern being played by the renderer
+type renderJob struct {
+	pattern Pattern
+	start   time.Time
+	// 图案结束时发送nil，写入出错时发送错误
+	done chan error
+
+	rendered bool
+	last     Color
+	// 上一帧是否处于交叉渐变中，渐变结束后还要写入一次最终颜色
+	crossfaded bool
+}
+
+// renderer is the single goroutine of a controller that draws patterns.
+// It ticks at the frame rate while a pattern is playing, sleeps through holds and
+// blocks without a timer while idle. Closing the controller stops it, the next pattern starts it again.
+type renderer struct {
+	c *Controller
+
+	// 渲染一帧期间一直持有，cancel返回后被取消的图案不会再写入
+	mu       sync.Mutex
+	job      *renderJob
+	interval time.Duration
+	// goroutine是否在运行
+	running bool
+
+	wake chan struct{}
+	// 停止时close(stop)，goroutine退出时close(exited)，每次启动使用新的一对
+	stop   chan struct{}
+	exited chan struct{}
+	// 串行化close
+	closeMu sync.Mutex
+}
+
+// newRenderer creates the renderer of a controller, the goroutine starts with the first pattern
+func newRenderer(c *Controller, frameRate int) *renderer {
+	if frameRate <= 0 {
+		frameRate = DEFAULT_FRAME_RATE
+	}
+	return &renderer{
+		c:        c,
+		interval: time.Second / time.Duration(frameRate),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// play makes a pattern the one being rendered, a pattern still playing ends as if finished
+func (r *renderer) play(p Pattern) *renderJob {
+	job := &renderJob{pattern: p, start: r.c.clock.Now(), done: make(chan error, 1)}
+
+	r.mu.Lock()
+	if r.job != nil {
+		log.Println("renderer: 新的图案替换了正在播放的图案")
+		r.job.done <- nil
+	}
+	r.job = job
+	r.startLocked()
+	r.mu.Unlock()
+
+	r.notify()
+	return job
+}
+
+// startLocked starts the goroutine unless it is running, mu must be held
+func (r *renderer) startLocked() {
+	if r.running {
+		return
+	}
+	r.running = true
+	r.stop = make(chan struct{})
+	r.exited = make(chan struct{})
+	go r.run(r.stop, r.exited)
+}
+
+// close ends the pattern being played and waits for the goroutine to exit
+func (r *renderer) close() {
+	r.closeMu.Lock()
+	defer r.closeMu.Unlock()
+
+	r.mu.Lock()
+	if r.job != nil {
+		r.job.done <- fmt.Errorf("控制器已关闭")
+		r.job = nil
+	}
+	running, stop, exited := r.running, r.stop, r.exited
+	r.mu.Unlock()
+	if !running {
+		return
+	}
+
+	close(stop)
+	<-exited
+	r.mu.Lock()
+	r.running = false
+	// 等待退出期间开始的图案由新的goroutine渲染
+	if r.job != nil {
+		r.startLocked()
+	}
+	r.mu.Unlock()
+}
+
+// cancel stops rendering a job, once it returns the job writes no more frames
+func (r *renderer) cancel(job *renderJob) {
+	r.mu.Lock()
+	if r.job == job {
+		r.job = nil
+	}
+	r.mu.Unlock()
+	// 唤醒渲染循环，让它停掉等待中的计时器
+	r.notify()
+}
+
+// notify wakes the render loop so it picks up a change immediately
+func (r *renderer) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run is the render loop
+func (r *renderer) run(stop, exited chan struct{}) {
+	defer close(exited)
+	var timer Timer
+	for {
+		wait, active := r.frame()
+		if !active {
+			select {
+			case <-r.wake:
+			case <-stop:
+				return
+			}
+			continue
+		}
+		if timer == nil {
+			timer = r.c.clock.NewTimer(wait)
+		} else {
+			timer.Reset(wait)
+		}
+		select {
+		case <-r.wake:
+			timer.Stop()
+		case <-timer.C():
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// frame renders the current job at the current time and returns how long to wait for the next frame,
+// active is false when there is nothing to render
+func (r *renderer) frame() (wait time.Duration, active bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job := r.job
+	if job == nil {
+		return 0, false
+	}
+
+	color, hold, done := job.pattern.Frame(r.c.clock.Now().Sub(job.start))
+	// 交叉渐变期间图案颜色不变时输出颜色也在变化
+	crossfading := r.c.crossfadeActive()
+	if !job.rendered || color != job.last || crossfading || job.crossfaded {
+		if err := r.c.setColor(color); err != nil {
+			log.Printf("renderer: 设置颜色时出错: %v", err)
+			r.c.setColor(ColorOff)
+			r.finish(job, err)
+			return 0, false
+		}
+		job.rendered = true
+		job.last = color
+	}
+	job.crossfaded = crossfading
+	if done {
+		r.finish(job, nil)
+		return 0, false
+	}
+
+	// 渐变按帧率渲染，常亮等到段结束
+	wait = r.interval
+	// 交叉渐变期间常亮段也需要逐帧渲染
+	if hold > wait && !crossfading {
+		wait = hold
+	}
+	return wait, true
+}
+
+// finish reports the end of a job, mu must be held
+func (r *renderer) finish(job *renderJob, err error) {
+	job.done <- err
+	r.job = nil
+}
+
+// setFrameRate changes the frame rate, taking effect on the next frame
+func (r *renderer) setFrameRate(frameRate int) {
+	r.mu.Lock()
+	r.interval = time.Second / time.Duration(frameRate)
+	r.mu.Unlock()
+	r.notify()
+}
+
+// frameRate returns the frame rate
+func (r *renderer) frameRate() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int(time.Second / r.interval)
+}
+
+// playPattern renders a pattern until it ends or ctx is cancelled.
+// Frames are computed from the start time, so timing does not drift with write latency.
+// The LED is switched off when stopped, and left at the final color when the pattern ends.
+func (c *Controller) playPattern(ctx context.Context, p Pattern) error {
+	job := c.renderer.play(p)
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		c.renderer.cancel(job)
+		c.setColor(ColorOff)
+		return nil
+	}
+}
+
+// SetFrameRate sets how many frames per second fading patterns are rendered at
+func (c *Controller) SetFrameRate(frameRate int) error {
+	if frameRate < MIN_FRAME_RATE || frameRate > MAX_FRAME_RATE {
+		return fmt.Errorf("帧率必须在%d-%d范围内", MIN_FRAME_RATE, MAX_FRAME_RATE)
+	}
+	c.renderer.setFrameRate(frameRate)
+	return nil
+}
+
+// GetFrameRate returns the render frame rate in frames per second
+func (c *Controller) GetFrameRate() int {
+	return c.renderer.frameRate()
+}
@@ -0,0 +1,65 @@
+package ledcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// rendererExited reports whether the render goroutine started last has exited
+func rendererExited(c *Controller) bool {
+	c.renderer.mu.Lock()
+	exited := c.renderer.exited
+	c.renderer.mu.Unlock()
+	select {
+	case <-exited:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestCloseStopsRenderer(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+
+	// 直接播放的图案在关闭时结束
+	done := make(chan error, 1)
+	go func() {
+		done <- c.FadeColor(context.Background(), ColorOff, ColorRed, time.Second)
+	}()
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("FadeColor did not wait on the clock")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !rendererExited(c) {
+		t.Fatal("render goroutine still running after Close")
+	}
+	if err := <-done; err == nil {
+		t.Error("fade interrupted by Close returned nil")
+	}
+	if clock.PendingTimers() != 0 {
+		t.Errorf("%d timers pending after Close", clock.PendingTimers())
+	}
+
+	// 关闭后再播放图案时重新启动
+	go func() {
+		done <- c.BlinkColor(context.Background(), ColorBlue, 1, 100*time.Millisecond, 100*time.Millisecond)
+	}()
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("BlinkColor after Close did not wait on the clock")
+	}
+	clock.Advance(200 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !rendererExited(c) {
+		t.Error("restarted render goroutine still running after Close")
+	}
+}
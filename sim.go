@@ -0,0 +1,208 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DEFAULT_SIM_HISTORY is the number of writes the simulated backend keeps by default
+const DEFAULT_SIM_HISTORY = 10000
+
+// SimWrite is one channel write recorded by the simulated backend
+type SimWrite struct {
+	Time    time.Time
+	Channel int
+	Value   int
+}
+
+// SimBackend is an in-memory backend for tests and machines without LEDs.
+// It records the most recent writes with their time and can inject errors, latency and permission denials.
+type SimBackend struct {
+	mu sync.Mutex
+	// 写入记录的时间来源
+	clock Clock
+	// 各通道的当前值
+	values [3]int
+	// 最近的写入记录，写满后从next处循环覆盖最旧的记录
+	writes  []SimWrite
+	next    int
+	history int
+	// 成功写入的总次数，包括已被覆盖的记录
+	total int
+
+	// 注入的故障
+	writeErr error
+	latency  time.Duration
+	denied   bool
+	// 从第failBase次写入起再成功failAfter次，之后全部失败，-1表示不限制
+	failAfter int
+	failBase  int
+}
+
+// NewSimBackend creates a simulated backend with all channels off
+func NewSimBackend() *SimBackend {
+	return &SimBackend{clock: SystemClock(), history: DEFAULT_SIM_HISTORY, failAfter: -1}
+}
+
+// WriteChannel records a 0-255 value, or fails if a failure is injected.
+// Injected latency is spent in real time before the write, holding the backend like a slow device would.
+func (b *SimBackend) WriteChannel(channel int, value int) error {
+	if channel < CHANNEL_RED || channel > CHANNEL_BLUE {
+		return fmt.Errorf("无效的通道: %d", channel)
+	}
+	if value < 0 || value > 255 {
+		return fmt.Errorf("通道值必须在0-255范围内: %d", value)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.latency > 0 {
+		time.Sleep(b.latency)
+	}
+	if b.denied {
+		return &os.PathError{Op: "open", Path: simChannelPath(channel), Err: os.ErrPermission}
+	}
+	if b.writeErr != nil {
+		return b.writeErr
+	}
+	if b.failAfter >= 0 && b.total >= b.failBase+b.failAfter {
+		return fmt.Errorf("模拟写入失败: %s", simChannelPath(channel))
+	}
+
+	b.values[channel] = value
+	b.record(SimWrite{Time: b.clock.Now(), Channel: channel, Value: value})
+	return nil
+}
+
+// record counts a write and keeps it in the history, mutex must be held
+func (b *SimBackend) record(w SimWrite) {
+	b.total++
+	if b.history == 0 {
+		return
+	}
+	if len(b.writes) < b.history {
+		b.writes = append(b.writes, w)
+		return
+	}
+	b.writes[b.next] = w
+	b.next = (b.next + 1) % b.history
+}
+
+// ordered returns the kept writes oldest first, mutex must be held
+func (b *SimBackend) ordered() []SimWrite {
+	writes := make([]SimWrite, 0, len(b.writes))
+	writes = append(writes, b.writes[b.next:]...)
+	return append(writes, b.writes[:b.next]...)
+}
+
+// ReadChannel returns the current value of a channel
+func (b *SimBackend) ReadChannel(channel int) (int, error) {
+	if channel < CHANNEL_RED || channel > CHANNEL_BLUE {
+		return 0, fmt.Errorf("无效的通道: %d", channel)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.values[channel], nil
+}
+
+// Capabilities reports the simulated backend capabilities
+func (b *SimBackend) Capabilities() *Capabilities {
+	return &Capabilities{
+		Channels:      3,
+		MaxBrightness: 255,
+		Readable:      true,
+	}
+}
+
+// Color returns the color currently shown
+func (b *SimBackend) Color() *Color {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &Color{b.values[CHANNEL_RED], b.values[CHANNEL_GREEN], b.values[CHANNEL_BLUE]}
+}
+
+// Writes returns a copy of the kept writes, oldest first
+func (b *SimBackend) Writes() []SimWrite {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ordered()
+}
+
+// WriteCount returns the number of successful writes so far, including those no longer kept
+func (b *SimBackend) WriteCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// ClearWrites forgets the recorded writes and resets the count, the current color is kept
+func (b *SimBackend) ClearWrites() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes = nil
+	b.next = 0
+	b.total = 0
+	b.failBase = 0
+}
+
+// SetHistoryLimit keeps only the most recent n writes, 0 stops recording them.
+// The default is DEFAULT_SIM_HISTORY; WriteCount still counts every write.
+func (b *SimBackend) SetHistoryLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	writes := b.ordered()
+	if len(writes) > n {
+		writes = writes[len(writes)-n:]
+	}
+	b.writes = writes
+	b.next = 0
+	b.history = n
+}
+
+// SetWriteError makes every write fail with err, nil restores normal writes
+func (b *SimBackend) SetWriteError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writeErr = err
+}
+
+// FailAfter lets the next n writes succeed and fails every write after them, -1 disables it
+func (b *SimBackend) FailAfter(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failAfter = n
+	b.failBase = b.total
+}
+
+// SetClock sets the clock write times are taken from, usually the controller's FakeClock
+func (b *SimBackend) SetClock(clock Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clock = clock
+}
+
+// SetLatency delays every write by d
+func (b *SimBackend) SetLatency(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.latency = d
+}
+
+// SetPermissionDenied makes writes fail like a brightness file the process may not open
+func (b *SimBackend) SetPermissionDenied(denied bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.denied = denied
+}
+
+// simChannelPath is the path reported in simulated errors
+func simChannelPath(channel int) string {
+	name := []string{LED_COLOR_RED, LED_COLOR_GREEN, LED_COLOR_BLUE}[channel]
+	return fmt.Sprintf("sim:%s/brightness", name)
+}
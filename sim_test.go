@@ -0,0 +1,99 @@
+package ledcontroller
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSimFaultInjection(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	sim.SetClock(clock)
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+
+	injected := errors.New("injected")
+	sim.SetWriteError(injected)
+	if err := sim.WriteChannel(CHANNEL_RED, 10); err != injected {
+		t.Errorf("write with an injected error returned %v", err)
+	}
+	if err := c.SetRGB(10, 20, 30); err == nil {
+		t.Error("SetRGB succeeded with an injected write error")
+	}
+	sim.SetWriteError(nil)
+
+	sim.SetPermissionDenied(true)
+	if err := sim.WriteChannel(CHANNEL_GREEN, 10); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("write with permission denied returned %v", err)
+	}
+	sim.SetPermissionDenied(false)
+	if count := sim.WriteCount(); count != 0 {
+		t.Fatalf("failed writes were recorded, count = %d", count)
+	}
+
+	sim.FailAfter(2)
+	for i, wantErr := range []bool{false, false, true, true} {
+		if err := sim.WriteChannel(CHANNEL_BLUE, i); (err != nil) != wantErr {
+			t.Errorf("write %d after FailAfter(2) returned %v", i, err)
+		}
+	}
+	sim.FailAfter(-1)
+
+	// 延迟消耗真实时间，记录的时间仍然来自模拟时钟
+	sim.SetLatency(20 * time.Millisecond)
+	began := time.Now()
+	if err := sim.WriteChannel(CHANNEL_RED, 99); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(began); elapsed < 20*time.Millisecond {
+		t.Errorf("write with 20ms latency took %v", elapsed)
+	}
+	writes := sim.Writes()
+	if last := writes[len(writes)-1]; !last.Time.Equal(clock.Now()) || last.Value != 99 {
+		t.Errorf("last write = %+v, want 99 at the fake clock time", last)
+	}
+	if color := sim.Color(); *color != (Color{99, 0, 1}) {
+		t.Errorf("color = %v, want {99 0 1}", *color)
+	}
+}
+
+func TestSimHistoryLimit(t *testing.T) {
+	sim := NewSimBackend()
+	sim.SetHistoryLimit(3)
+	for i := 0; i < 5; i++ {
+		sim.WriteChannel(CHANNEL_RED, i)
+	}
+	if count := sim.WriteCount(); count != 5 {
+		t.Errorf("WriteCount = %d, want 5", count)
+	}
+	var values []int
+	for _, w := range sim.Writes() {
+		values = append(values, w.Value)
+	}
+	if len(values) != 3 || values[0] != 2 || values[1] != 3 || values[2] != 4 {
+		t.Errorf("kept writes %v, want the last three [2 3 4]", values)
+	}
+
+	// FailAfter按总次数计算，不受覆盖影响
+	sim.FailAfter(1)
+	if err := sim.WriteChannel(CHANNEL_RED, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.WriteChannel(CHANNEL_RED, 6); err == nil {
+		t.Error("second write after FailAfter(1) succeeded")
+	}
+	sim.FailAfter(-1)
+
+	sim.SetHistoryLimit(0)
+	sim.WriteChannel(CHANNEL_GREEN, 7)
+	if writes := sim.Writes(); len(writes) != 0 {
+		t.Errorf("kept %d writes with recording off", len(writes))
+	}
+	if count := sim.WriteCount(); count != 7 {
+		t.Errorf("WriteCount with recording off = %d, want 7", count)
+	}
+	if color := sim.Color(); *color != (Color{5, 7, 0}) {
+		t.Errorf("color = %v, want {5 7 0}", *color)
+	}
+}
@@ -0,0 +1,143 @@
+package ledcontroller
+
+import (
+	"log"
+	"time"
+)
+
+// pushBackgroundEffect puts a persistent effect on the background stack,
+// replacing an earlier entry of the same type, mutex must be held
+func (c *Controller) pushBackgroundEffect(req *effectRequest) {
+	for i, entry := range c.backgroundEffects {
+		if entry.effectType == req.effectType {
+			c.backgroundEffects = append(c.backgroundEffects[:i], c.backgroundEffects[i+1:]...)
+			break
+		}
+	}
+
+	// 插入到第一个优先级不高于它的条目之前
+	priority := c.effectPriorities[req.effectType]
+	index := len(c.backgroundEffects)
+	for i, entry := range c.backgroundEffects {
+		if c.effectPriorities[entry.effectType] <= priority {
+			index = i
+			break
+		}
+	}
+	c.backgroundEffects = append(c.backgroundEffects, nil)
+	copy(c.backgroundEffects[index+1:], c.backgroundEffects[index:])
+	c.backgroundEffects[index] = req
+}
+
+// popBackgroundEffect removes and returns the top background effect do-not-disturb allows now,
+// mutex must be held. Suppressed effects stay on the stack until do-not-disturb lifts.
+func (c *Controller) popBackgroundEffect() *effectRequest {
+	index := c.nextBackgroundEffect()
+	if index < 0 {
+		return nil
+	}
+	next := c.backgroundEffects[index]
+	c.backgroundEffects = append(c.backgroundEffects[:index], c.backgroundEffects[index+1:]...)
+	return next
+}
+
+// nextBackgroundEffect returns the index of the top background effect do-not-disturb allows now,
+// -1 if there is none, mutex must be held
+func (c *Controller) nextBackgroundEffect() int {
+	now := c.clock.Now()
+	for i, entry := range c.backgroundEffects {
+		if c.dndAction(entry.effectType, now) != DND_ACTION_SUPPRESS {
+			return i
+		}
+	}
+	return -1
+}
+
+// resumeBackgroundEffect starts the top background effect unless another effect started meanwhile,
+// which resumes it when it ends. Popping and starting under runMutex means a request arriving
+// at the same time is arbitrated against the resumed effect instead of being preempted by it.
+func (c *Controller) resumeBackgroundEffect() {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+
+	c.mutex.Lock()
+	var next *effectRequest
+	if !c.effectActive {
+		next = c.popBackgroundEffect()
+	}
+	c.mutex.Unlock()
+	if next == nil {
+		return
+	}
+
+	log.Printf("runTimedEffect: 恢复后台效果%d", next.effectType)
+	c.beginResumeCrossfade()
+	if c.startTimedEffectLocked(next) == DECISION_SUPPRESSED {
+		c.mutex.Lock()
+		c.pushBackgroundEffect(next)
+		c.mutex.Unlock()
+	}
+}
+
+// GetBackgroundEffect returns the effect that will resume when the current one ends
+func (c *Controller) GetBackgroundEffect() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.backgroundEffects) == 0 {
+		return EFFECT_NONE
+	}
+	return c.backgroundEffects[0].effectType
+}
+
+// StopAllEffects stops the current effect and drops every background effect
+func (c *Controller) StopAllEffects() {
+	c.mutex.Lock()
+	c.backgroundEffects = nil
+	c.mutex.Unlock()
+	c.StopCurrentEffect()
+}
+
+// SetResumeCrossfade sets how long a resumed background effect crossfades in, 0 disables it
+func (c *Controller) SetResumeCrossfade(ms int) {
+	if ms < 0 {
+		ms = 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.resumeCrossfade = time.Duration(ms) * time.Millisecond
+}
+
+// beginResumeCrossfade starts a crossfade from the last written color
+func (c *Controller) beginResumeCrossfade() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.resumeCrossfade <= 0 {
+		return
+	}
+	log.Printf("beginResumeCrossfade: 从 %v 交叉渐变 %v", c.lastColor, c.resumeCrossfade)
+	c.crossfadeFrom = c.lastColor
+	c.crossfadeStart = c.clock.Now()
+	c.crossfadeDuration = c.resumeCrossfade
+}
+
+// crossfadeActive reports whether a resume crossfade is in progress
+func (c *Controller) crossfadeActive() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.crossfadeDuration > 0 && c.clock.Now().Sub(c.crossfadeStart) < c.crossfadeDuration
+}
+
+// applyCrossfade blends a color with the crossfade start color while a crossfade is running
+func (c *Controller) applyCrossfade(color Color) Color {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.crossfadeDuration <= 0 {
+		return color
+	}
+	elapsed := c.clock.Now().Sub(c.crossfadeStart)
+	if elapsed >= c.crossfadeDuration {
+		c.crossfadeDuration = 0
+		return color
+	}
+	return lerpColor(c.crossfadeFrom, color, float64(elapsed)/float64(c.crossfadeDuration))
+}
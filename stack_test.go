@@ -0,0 +1,151 @@
+package ledcontroller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond in real time until it holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// holding returns an effect that shows a color until it is stopped
+func holding(c *Controller, color Color) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := c.setColor(color); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	}
+}
+
+// waitForColor waits until the simulated LED shows a color
+func waitForColor(t *testing.T, sim *SimBackend, want Color) {
+	t.Helper()
+	waitFor(t, fmt.Sprint(want), func() bool { return *sim.Color() == want })
+}
+
+// startCharging runs a persistent EFFECT_CHARGING_HIGH stand-in that plays a pattern until stopped
+func startCharging(t *testing.T, c *Controller, p Pattern) {
+	t.Helper()
+	if err := c.runTimedEffect(func(ctx context.Context) error {
+		return playing(p)(c, ctx)
+	}, EFFECT_CHARGING_HIGH); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeAfterTransientEffect(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	defer c.StopAllEffects()
+
+	if err := c.runTimedEffect(holding(c, ColorGreen), EFFECT_CHARGING_HIGH); err != nil {
+		t.Fatal(err)
+	}
+	waitForColor(t, sim, ColorGreen)
+
+	// 蓝牙已连接的蓝色保持3秒，打断充电效果
+	if err := c.BluetoothConnectedEffect(); err != nil {
+		t.Fatal(err)
+	}
+	waitForColor(t, sim, ColorBlue)
+	if background := c.GetBackgroundEffect(); background != EFFECT_CHARGING_HIGH {
+		t.Fatalf("background effect = %d, want %d", background, EFFECT_CHARGING_HIGH)
+	}
+
+	clock.Advance(3 * time.Second)
+	waitForColor(t, sim, ColorGreen)
+	if effect := c.GetCurrentEffect(); effect != EFFECT_CHARGING_HIGH {
+		t.Errorf("current effect = %d, want the resumed %d", effect, EFFECT_CHARGING_HIGH)
+	}
+	if background := c.GetBackgroundEffect(); background != EFFECT_NONE {
+		t.Errorf("background effect after resuming = %d, want none", background)
+	}
+}
+
+func TestResumeCrossfade(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	sim.SetClock(clock)
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	defer c.StopAllEffects()
+	c.SetResumeCrossfade(1000)
+	start := clock.Now()
+
+	startCharging(t, c, NewTimeline(0).Hold(ColorGreen, time.Minute))
+	waitForColor(t, sim, ColorGreen)
+	if err := c.BluetoothConnectedEffect(); err != nil {
+		t.Fatal(err)
+	}
+	waitForColor(t, sim, ColorBlue)
+
+	// 蓝色结束后不关灯，从蓝色经过1秒渐变到恢复的绿色
+	clock.Advance(3 * time.Second)
+	waitFor(t, "the resumed effect", func() bool { return c.GetCurrentEffect() == EFFECT_CHARGING_HIGH })
+	clock.Advance(500 * time.Millisecond)
+	if color := sim.Color(); color.Red != 0 || color.Green < 115 || color.Green > 140 || color.Blue < 115 || color.Blue > 140 {
+		t.Errorf("color halfway through the crossfade = %v, want about {0 128 128}", *color)
+	}
+	clock.Advance(600 * time.Millisecond)
+	waitForColor(t, sim, ColorGreen)
+
+	// 从蓝色结束到绿色之间没有关灯
+	var shown Color
+	for _, w := range sim.Writes() {
+		setColorChannel(&shown, w.Channel, w.Value)
+		if !w.Time.Before(start.Add(3*time.Second)) && shown == ColorOff {
+			t.Fatalf("the LED went off at %v between the transient and the resumed effect", w.Time.Sub(start))
+		}
+	}
+}
+
+func TestRequestDuringResumeIsNotPreempted(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	defer c.StopAllEffects()
+
+	if err := c.runTimedEffect(holding(c, ColorGreen), EFFECT_CHARGING_HIGH); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BluetoothConnectedEffect(); err != nil {
+		t.Fatal(err)
+	}
+	waitForColor(t, sim, ColorBlue)
+
+	// 前台效果结束后、后台效果恢复之前到来的请求
+	c.runMutex.Lock()
+	clock.Advance(3 * time.Second)
+	waitFor(t, "the transient effect to end", func() bool { return !c.IsEffectActive() })
+	decision := c.startTimedEffectLocked(&effectRequest{
+		effectType: EFFECT_CHARGING_COMPLETE,
+		effect:     holding(c, Color{255, 255, 255}),
+		persistent: true,
+	})
+	c.runMutex.Unlock()
+	if decision != DECISION_STARTED {
+		t.Fatalf("decision = %d, want started", decision)
+	}
+
+	// 恢复的后台效果不能抢占已经报告启动的效果
+	time.Sleep(20 * time.Millisecond)
+	if effect := c.GetCurrentEffect(); effect != EFFECT_CHARGING_COMPLETE {
+		t.Errorf("current effect = %d, want %d which was reported started", effect, EFFECT_CHARGING_COMPLETE)
+	}
+	if background := c.GetBackgroundEffect(); background != EFFECT_CHARGING_HIGH {
+		t.Errorf("background effect = %d, want %d still waiting", background, EFFECT_CHARGING_HIGH)
+	}
+}
@@ -0,0 +1,181 @@
+package ledcontroller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Tempo limits
+const (
+	DEFAULT_BPM = 120.0
+	MIN_BPM     = 30.0
+	MAX_BPM     = 300.0
+)
+
+const (
+	// 节奏同步的时间线按120BPM编写，一拍500ms
+	referenceBeat = time.Minute / time.Duration(DEFAULT_BPM)
+	// 两次Beat间隔超过该时间时重新开始测速
+	tapTimeout = 2 * time.Second
+	// 测速时最多使用的敲击次数
+	maxTaps = 8
+	// 同步播放时常亮段的最长等待时间，保证改变速度后及时生效
+	maxTempoHold = 50 * time.Millisecond
+)
+
+// Beats returns the nominal duration of n beats, used to author tempo-synced timelines.
+// Nominal durations are at 120 BPM and stretch or shrink with the tempo clock.
+func Beats(n float64) time.Duration {
+	// 四舍五入，避免浮点误差让段边界提前或推后一帧
+	return time.Duration(math.Round(n * float64(referenceBeat)))
+}
+
+// tempoClock counts beats at an adjustable tempo.
+// The beat position is continuous, so changing the tempo re-times effects without restarting them.
+type tempoClock struct {
+	mu    sync.Mutex
+	clock Clock
+
+	bpm float64
+	// 在anchorTime时刻的节拍位置
+	anchorBeats float64
+	anchorTime  time.Time
+	taps        []time.Time
+}
+
+// newTempoClock creates a clock running at the default tempo
+func newTempoClock(clock Clock) *tempoClock {
+	return &tempoClock{clock: clock, bpm: DEFAULT_BPM, anchorTime: clock.Now()}
+}
+
+// positionAt returns the beat position at a time, mutex must be held
+func (tc *tempoClock) positionAt(now time.Time) float64 {
+	return tc.anchorBeats + now.Sub(tc.anchorTime).Minutes()*tc.bpm
+}
+
+// position returns the current beat position and tempo
+func (tc *tempoClock) position() (float64, float64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.positionAt(tc.clock.Now()), tc.bpm
+}
+
+// setBPM changes the tempo, keeping the current beat position
+func (tc *tempoClock) setBPM(bpm float64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	now := tc.clock.Now()
+	tc.anchorBeats = tc.positionAt(now)
+	tc.anchorTime = now
+	tc.bpm = bpm
+}
+
+// setPhase moves the position by less than half a beat so that now is at phase within a beat
+func (tc *tempoClock) setPhase(phase float64) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	now := tc.clock.Now()
+	tc.anchorBeats = math.Round(tc.positionAt(now)-phase) + phase
+	tc.anchorTime = now
+}
+
+// tap registers a beat at the current time, measures the tempo from recent taps
+// and aligns the beat phase to the tap
+func (tc *tempoClock) tap() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	now := tc.clock.Now()
+	position := tc.positionAt(now)
+
+	if n := len(tc.taps); n > 0 && now.Sub(tc.taps[n-1]) > tapTimeout {
+		tc.taps = nil
+	}
+	tc.taps = append(tc.taps, now)
+	if len(tc.taps) > maxTaps {
+		tc.taps = tc.taps[len(tc.taps)-maxTaps:]
+	}
+
+	// 用最近几次敲击的平均间隔计算速度
+	if n := len(tc.taps); n >= 2 {
+		interval := tc.taps[n-1].Sub(tc.taps[0]) / time.Duration(n-1)
+		if bpm := float64(time.Minute) / float64(interval); bpm >= MIN_BPM && bpm <= MAX_BPM {
+			tc.bpm = bpm
+		}
+	}
+
+	// 敲击的时刻就是拍点
+	tc.anchorBeats = math.Round(position)
+	tc.anchorTime = now
+}
+
+// tempoPattern plays a pattern authored in nominal time against the tempo clock
+type tempoPattern struct {
+	pattern Pattern
+	clock   *tempoClock
+	// 开始播放时所在拍的起点，图案与拍点对齐
+	start float64
+}
+
+// synced returns a pattern that follows the tempo clock, starting on the current beat
+func (tc *tempoClock) synced(p Pattern) *tempoPattern {
+	position, _ := tc.position()
+	return &tempoPattern{pattern: p, clock: tc, start: math.Floor(position)}
+}
+
+// Frame maps the beat position to nominal time and scales the hold back to real time
+func (p *tempoPattern) Frame(t time.Duration) (Color, time.Duration, bool) {
+	position, bpm := p.clock.position()
+	color, hold, done := p.pattern.Frame(Beats(position - p.start))
+
+	hold = time.Duration(float64(hold) * DEFAULT_BPM / bpm)
+	if hold > maxTempoHold {
+		hold = maxTempoHold
+	}
+	return color, hold, done
+}
+
+// playingInTempo returns an effect function that plays a pattern synced to the controller's tempo clock
+func playingInTempo(p Pattern) func(c *Controller, ctx context.Context) error {
+	return func(c *Controller, ctx context.Context) error {
+		return c.playPattern(ctx, c.tempo.synced(p))
+	}
+}
+
+// SetBPM sets the tempo followed by rhythmic effects, running effects are re-timed immediately
+func (c *Controller) SetBPM(bpm float64) error {
+	if bpm < MIN_BPM || bpm > MAX_BPM {
+		return fmt.Errorf("BPM必须在%v-%v范围内", MIN_BPM, MAX_BPM)
+	}
+	c.tempo.setBPM(bpm)
+	return nil
+}
+
+// GetBPM returns the current tempo
+func (c *Controller) GetBPM() float64 {
+	_, bpm := c.tempo.position()
+	return bpm
+}
+
+// SetBeatPhase declares where in the current beat the music is, 0 meaning exactly on a beat
+func (c *Controller) SetBeatPhase(phase float64) error {
+	if phase < 0 || phase >= 1 {
+		return fmt.Errorf("节拍相位必须在[0, 1)范围内")
+	}
+	c.tempo.setPhase(phase)
+	return nil
+}
+
+// GetBeatPhase returns the position within the current beat, in [0, 1)
+func (c *Controller) GetBeatPhase() float64 {
+	position, _ := c.tempo.position()
+	return position - math.Floor(position)
+}
+
+// Beat is the tap-tempo input: call it on every beat, the tempo is measured from
+// the recent calls and the beat phase aligned to the latest one
+func (c *Controller) Beat() {
+	c.tempo.tap()
+}
@@ -0,0 +1,83 @@
+package ledcontroller
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// TerminalBackend draws the LED color as a swatch on a true-color terminal,
+// for trying out effects on a machine without LEDs
+type TerminalBackend struct {
+	w io.Writer
+
+	mu sync.Mutex
+	// 当前颜色，drawn为false时还没有画过
+	values [3]int
+	drawn  bool
+}
+
+// NewTerminalBackend creates a backend drawing on w, usually os.Stdout
+func NewTerminalBackend(w io.Writer) *TerminalBackend {
+	return &TerminalBackend{w: w}
+}
+
+// WriteColor redraws the swatch in a new color
+func (b *TerminalBackend) WriteColor(color Color) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.drawLocked([3]int{color.Red, color.Green, color.Blue})
+}
+
+// WriteChannel updates one channel and redraws the swatch
+func (b *TerminalBackend) WriteChannel(channel int, value int) error {
+	if channel < CHANNEL_RED || channel > CHANNEL_BLUE {
+		return fmt.Errorf("无效的通道: %d", channel)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	values := b.values
+	values[channel] = value
+	return b.drawLocked(values)
+}
+
+// drawLocked draws the swatch over the previous one, unless the color is unchanged. mu must be held.
+func (b *TerminalBackend) drawLocked(values [3]int) error {
+	for _, value := range values {
+		if value < 0 || value > 255 {
+			return fmt.Errorf("通道值必须在0-255范围内: %d", value)
+		}
+	}
+	if b.drawn && values == b.values {
+		return nil
+	}
+
+	// 回到行首，用24位背景色画色块，后面跟十六进制值
+	color := &Color{values[0], values[1], values[2]}
+	if _, err := fmt.Fprintf(b.w, "\r\x1b[48;2;%d;%d;%dm        \x1b[0m %s", values[0], values[1], values[2], color.Hex()); err != nil {
+		return err
+	}
+	b.values = values
+	b.drawn = true
+	return nil
+}
+
+// ReadChannel returns the current value of a channel
+func (b *TerminalBackend) ReadChannel(channel int) (int, error) {
+	if channel < CHANNEL_RED || channel > CHANNEL_BLUE {
+		return 0, fmt.Errorf("无效的通道: %d", channel)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.values[channel], nil
+}
+
+// Capabilities reports the terminal backend capabilities
+func (b *TerminalBackend) Capabilities() *Capabilities {
+	return &Capabilities{
+		Channels:      3,
+		MaxBrightness: 255,
+		Readable:      true,
+		AtomicColor:   true,
+	}
+}
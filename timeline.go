@@ -0,0 +1,185 @@
+package ledcontroller
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Segment kinds
+const (
+	SEGMENT_HOLD = 0
+	SEGMENT_FADE = 1
+	SEGMENT_EASE = 2
+)
+
+// frameInterval is the frame duration at the default frame rate
+const frameInterval = time.Second / DEFAULT_FRAME_RATE
+
+// Pattern is an effect expressed as a function of time since it started
+type Pattern interface {
+	// Frame returns the color at t, how long that color stays unchanged,
+	// and whether the pattern has ended
+	Frame(t time.Duration) (color Color, hold time.Duration, done bool)
+}
+
+// Segment is one step of a timeline
+type Segment struct {
+	Kind     int
+	Duration time.Duration
+	From     Color
+	To       Color
+	// 渐变段的缓动曲线和颜色空间，nil表示按Kind线性或平滑插值
+	Interpolation *Interpolation
+}
+
+// colorAt returns the segment color at offset t
+func (s *Segment) colorAt(t time.Duration) Color {
+	if s.Kind == SEGMENT_HOLD || s.Duration <= 0 {
+		return s.To
+	}
+	progress := float64(t) / float64(s.Duration)
+	if s.Interpolation != nil {
+		return s.Interpolation.color(s.From, s.To, progress)
+	}
+	if s.Kind == SEGMENT_EASE {
+		progress = easeInOut(progress)
+	}
+	return lerpColor(s.From, s.To, progress)
+}
+
+// Timeline is a list of segments played back against a monotonic start time
+type Timeline struct {
+	Segments []*Segment
+	// 播放次数，0表示循环直到停止
+	Repeat int
+
+	duration time.Duration
+}
+
+// NewTimeline creates an empty timeline played repeat times, 0 loops until stopped
+func NewTimeline(repeat int) *Timeline {
+	return &Timeline{Repeat: repeat}
+}
+
+// add appends a segment
+func (tl *Timeline) add(s *Segment) *Timeline {
+	tl.Segments = append(tl.Segments, s)
+	tl.duration += s.Duration
+	return tl
+}
+
+// last returns the color at the end of the timeline so far
+func (tl *Timeline) last() Color {
+	if len(tl.Segments) == 0 {
+		return ColorOff
+	}
+	return tl.Segments[len(tl.Segments)-1].To
+}
+
+// Hold shows a solid color for d
+func (tl *Timeline) Hold(color Color, d time.Duration) *Timeline {
+	return tl.add(&Segment{Kind: SEGMENT_HOLD, Duration: d, From: color, To: color})
+}
+
+// Fade linearly fades from one color to another over d
+func (tl *Timeline) Fade(from, to Color, d time.Duration) *Timeline {
+	return tl.add(&Segment{Kind: SEGMENT_FADE, Duration: d, From: from, To: to})
+}
+
+// FadeTo linearly fades from the current end color to another over d
+func (tl *Timeline) FadeTo(to Color, d time.Duration) *Timeline {
+	return tl.Fade(tl.last(), to, d)
+}
+
+// FadeWith fades from one color to another over d with the given easing and color space.
+// An invalid interpolation is logged and falls back to a linear fade.
+func (tl *Timeline) FadeWith(from, to Color, d time.Duration, interp *Interpolation) *Timeline {
+	compiled, err := interp.compile()
+	if err != nil {
+		log.Printf("FadeWith: %v，改为线性渐变", err)
+		compiled = nil
+	}
+	return tl.add(&Segment{Kind: SEGMENT_FADE, Duration: d, From: from, To: to, Interpolation: compiled})
+}
+
+// FadeToWith fades from the current end color to another over d with the given easing and color space
+func (tl *Timeline) FadeToWith(to Color, d time.Duration, interp *Interpolation) *Timeline {
+	return tl.FadeWith(tl.last(), to, d, interp)
+}
+
+// Ease fades from one color to another over d, slow at both ends
+func (tl *Timeline) Ease(from, to Color, d time.Duration) *Timeline {
+	return tl.add(&Segment{Kind: SEGMENT_EASE, Duration: d, From: from, To: to})
+}
+
+// Ramp fades a single channel from one value to another over d,
+// the other channels keep the current end color
+func (tl *Timeline) Ramp(channel, from, to int, d time.Duration) *Timeline {
+	start, end := tl.last(), tl.last()
+	setColorChannel(&start, channel, from)
+	setColorChannel(&end, channel, to)
+	return tl.Fade(start, end, d)
+}
+
+// Duration returns the length of a single play of the timeline
+func (tl *Timeline) Duration() time.Duration {
+	return tl.duration
+}
+
+// Frame returns the color at t, how long it stays unchanged and whether the timeline has ended
+func (tl *Timeline) Frame(t time.Duration) (Color, time.Duration, bool) {
+	if tl.duration <= 0 {
+		return tl.last(), 0, true
+	}
+	if tl.Repeat > 0 && t >= time.Duration(tl.Repeat)*tl.duration {
+		return tl.last(), 0, true
+	}
+
+	offset := t % tl.duration
+	for _, s := range tl.Segments {
+		if offset < s.Duration {
+			if s.Kind == SEGMENT_HOLD {
+				return s.To, s.Duration - offset, false
+			}
+			return s.colorAt(offset), 0, false
+		}
+		offset -= s.Duration
+	}
+	return tl.last(), 0, false
+}
+
+// playing returns an effect function that plays a pattern on a controller,
+// runTimedEffect switches the LED off afterwards
+func playing(p Pattern) func(c *Controller, ctx context.Context) error {
+	return func(c *Controller, ctx context.Context) error {
+		return c.playPattern(ctx, p)
+	}
+}
+
+// lerpColor interpolates linearly between two colors. Overshooting easing curves
+// move progress outside [0, 1], so the channels are clamped to 0-255.
+func lerpColor(from, to Color, progress float64) Color {
+	return Color{
+		clampChannel(from.Red + int(progress*float64(to.Red-from.Red))),
+		clampChannel(from.Green + int(progress*float64(to.Green-from.Green))),
+		clampChannel(from.Blue + int(progress*float64(to.Blue-from.Blue))),
+	}
+}
+
+// easeInOut is the smoothstep curve, slow at both ends
+func easeInOut(progress float64) float64 {
+	return progress * progress * (3 - 2*progress)
+}
+
+// setColorChannel sets a single channel of a color
+func setColorChannel(color *Color, channel, value int) {
+	switch channel {
+	case CHANNEL_RED:
+		color.Red = value
+	case CHANNEL_GREEN:
+		color.Green = value
+	case CHANNEL_BLUE:
+		color.Blue = value
+	}
+}
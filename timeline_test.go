@@ -0,0 +1,65 @@
+package ledcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLerpColorClamps(t *testing.T) {
+	tests := []struct {
+		progress float64
+		want     Color
+	}{
+		{0, Color{50, 100, 200}},
+		{1, Color{250, 100, 0}},
+		{-0.5, Color{0, 100, 255}},
+		{1.5, Color{255, 100, 0}},
+	}
+	for _, tt := range tests {
+		if color := lerpColor(Color{50, 100, 200}, Color{250, 100, 0}, tt.progress); color != tt.want {
+			t.Errorf("lerpColor at %v = %v, want %v", tt.progress, color, tt.want)
+		}
+	}
+}
+
+func TestFadeWithOvershootingCurve(t *testing.T) {
+	sim := NewSimBackend()
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: sim, Clock: clock})
+	interp, err := NewInterpolation("cubic-bezier(0.3, -0.6, 0.7, 1.6)", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.FadeColorWith(context.Background(), Color{20, 20, 20}, Color{235, 235, 235}, 200*time.Millisecond, interp)
+	}()
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("FadeColorWith did not wait on the clock")
+	}
+	clock.Advance(300 * time.Millisecond)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("fade with an overshooting curve failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("FadeColorWith did not return")
+	}
+
+	// 曲线先低于起点再超过终点，两端都被截断在0-255范围内
+	low, high := 255, 0
+	for _, w := range sim.Writes() {
+		if w.Value < low {
+			low = w.Value
+		}
+		if w.Value > high {
+			high = w.Value
+		}
+	}
+	if low != 0 || high != 255 {
+		t.Errorf("fade wrote values from %d to %d, want the overshoot clamped to 0 and 255", low, high)
+	}
+}
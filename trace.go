@@ -0,0 +1,305 @@
+package ledcontroller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TRACE_VERSION is the trace format version written by this package
+const TRACE_VERSION = 1
+
+// traceCSVHeader is the first line of a CSV trace
+const traceCSVHeader = "time_us,red,green,blue,effect"
+
+// TraceEvent is one output color change, at an offset from the start of the recording
+type TraceEvent struct {
+	Offset time.Duration
+	Color  Color
+	// 写入时正在运行的效果，EFFECT_NONE表示直接设置的颜色
+	Effect int
+}
+
+// Trace is a recorded sequence of output colors, for example as JSON:
+//
+//	{"version": 1, "events": [[0, 255, 0, 0, 3], [200000, 0, 0, 0, 3]]}
+//
+// Each event is [microseconds since start, red, green, blue, effect type]. The CSV form has
+// the header time_us,red,green,blue,effect and one event per line.
+// Colors are recorded as written to the backend, after brightness, night mode and calibration.
+// Effects offloaded to kernel triggers only record the color the trigger was armed with.
+type Trace struct {
+	Version int           `json:"version"`
+	Events  []*TraceEvent `json:"events"`
+}
+
+// traceRecorder collects the colors written while tracing
+type traceRecorder struct {
+	start  time.Time
+	events []*TraceEvent
+}
+
+// MarshalJSON encodes the event as [time_us, red, green, blue, effect]
+func (e *TraceEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal([5]int64{
+		e.Offset.Microseconds(),
+		int64(e.Color.Red), int64(e.Color.Green), int64(e.Color.Blue),
+		int64(e.Effect),
+	})
+}
+
+// UnmarshalJSON decodes an event written by MarshalJSON
+func (e *TraceEvent) UnmarshalJSON(data []byte) error {
+	var values []int64
+	if err := json.Unmarshal(data, &values); err != nil || len(values) != 5 {
+		return fmt.Errorf("轨迹事件必须是[time_us, r, g, b, effect]")
+	}
+	return e.set(values)
+}
+
+// set fills the event from [time_us, red, green, blue, effect] and validates it
+func (e *TraceEvent) set(values []int64) error {
+	if values[0] < 0 {
+		return fmt.Errorf("轨迹事件的时间不能为负数")
+	}
+	for _, value := range values[1:4] {
+		if value < 0 || value > 255 {
+			return fmt.Errorf("轨迹事件的颜色值必须在0-255范围内")
+		}
+	}
+	e.Offset = time.Duration(values[0]) * time.Microsecond
+	e.Color = Color{int(values[1]), int(values[2]), int(values[3])}
+	e.Effect = int(values[4])
+	return nil
+}
+
+// ParseTrace parses a JSON or CSV trace
+func ParseTrace(data []byte) (*Trace, error) {
+	t := &Trace{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, t); err != nil {
+			return nil, fmt.Errorf("解析轨迹文件失败: %v", err)
+		}
+	} else if err := t.parseCSV(data); err != nil {
+		return nil, err
+	}
+
+	if t.Version > TRACE_VERSION {
+		return nil, fmt.Errorf("不支持的轨迹文件版本: %d", t.Version)
+	}
+	for i, e := range t.Events {
+		// JSON中的null不会调用UnmarshalJSON，解码为nil
+		if e == nil {
+			return nil, fmt.Errorf("第%d个轨迹事件为空", i+1)
+		}
+	}
+	for i := 1; i < len(t.Events); i++ {
+		if t.Events[i].Offset < t.Events[i-1].Offset {
+			return nil, fmt.Errorf("第%d个轨迹事件的时间早于前一个事件", i+1)
+		}
+	}
+	return t, nil
+}
+
+// parseCSV reads the CSV form, the header line is optional
+func (t *Trace) parseCSV(data []byte) error {
+	t.Version = TRACE_VERSION
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text == traceCSVHeader {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		if len(fields) != 5 {
+			return fmt.Errorf("轨迹文件第%d行应有5列", line)
+		}
+		values := make([]int64, len(fields))
+		for i, field := range fields {
+			value, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+			if err != nil {
+				return fmt.Errorf("轨迹文件第%d行格式错误: %v", line, err)
+			}
+			values[i] = value
+		}
+		event := &TraceEvent{}
+		if err := event.set(values); err != nil {
+			return fmt.Errorf("轨迹文件第%d行: %v", line, err)
+		}
+		t.Events = append(t.Events, event)
+	}
+	return scanner.Err()
+}
+
+// LoadTraceFile reads a JSON or CSV trace from a file
+func LoadTraceFile(path string) (*Trace, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取轨迹文件失败: %v", err)
+	}
+	return ParseTrace(data)
+}
+
+// WriteJSON writes the trace in its JSON form
+func (t *Trace) WriteJSON(w io.Writer) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteCSV writes the trace in its CSV form
+func (t *Trace) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, traceCSVHeader)
+	for _, e := range t.Events {
+		fmt.Fprintf(bw, "%d,%d,%d,%d,%d\n", e.Offset.Microseconds(), e.Color.Red, e.Color.Green, e.Color.Blue, e.Effect)
+	}
+	return bw.Flush()
+}
+
+// Save writes the trace to a file, as CSV if the name ends in .csv and as JSON otherwise
+func (t *Trace) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建轨迹文件失败: %v", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = t.WriteCSV(f)
+	} else {
+		err = t.WriteJSON(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("写入轨迹文件失败: %v", err)
+	}
+	return nil
+}
+
+// Duration returns the offset of the last event
+func (t *Trace) Duration() time.Duration {
+	if len(t.Events) == 0 {
+		return 0
+	}
+	return t.Events[len(t.Events)-1].Offset
+}
+
+// ColorAt returns the color shown at an offset, off before the first event
+func (t *Trace) ColorAt(offset time.Duration) Color {
+	color := ColorOff
+	for _, e := range t.Events {
+		if e.Offset > offset {
+			break
+		}
+		color = e.Color
+	}
+	return color
+}
+
+// Compare checks that another trace shows the same colors for the same effects in the same order,
+// with every event within tolerance of its time here. It describes the first difference.
+func (t *Trace) Compare(other *Trace, tolerance time.Duration) error {
+	for i, e := range t.Events {
+		if i >= len(other.Events) {
+			return fmt.Errorf("轨迹缺少第%d个事件及之后的%d个事件", i+1, len(t.Events)-i)
+		}
+		o := other.Events[i]
+		if o.Color != e.Color || o.Effect != e.Effect {
+			return fmt.Errorf("第%d个事件不同: 期望 %v(效果%d)，实际 %v(效果%d)", i+1, e.Color, e.Effect, o.Color, o.Effect)
+		}
+		if diff := o.Offset - e.Offset; diff > tolerance || diff < -tolerance {
+			return fmt.Errorf("第%d个事件的时间相差%v: 期望 %v，实际 %v", i+1, diff, e.Offset, o.Offset)
+		}
+	}
+	if len(other.Events) > len(t.Events) {
+		return fmt.Errorf("轨迹多出%d个事件", len(other.Events)-len(t.Events))
+	}
+	return nil
+}
+
+// Replay writes the recorded colors to a backend at their recorded times, until the end or ctx is cancelled.
+// The colors are written as recorded, without brightness or calibration.
+func (t *Trace) Replay(ctx context.Context, b Backend) error {
+	return t.ReplayWithClock(ctx, b, SystemClock())
+}
+
+// ReplayWithClock is Replay timed by the given clock
+func (t *Trace) ReplayWithClock(ctx context.Context, b Backend, clock Clock) error {
+	log.Printf("Replay: 开始回放%d个轨迹事件，时长 %v", len(t.Events), t.Duration())
+	start := clock.Now()
+	for _, e := range t.Events {
+		if !sleepContext(ctx, clock, e.Offset-clock.Now().Sub(start)) {
+			return nil
+		}
+		if err := writeBackendColor(b, e.Color); err != nil {
+			return err
+		}
+	}
+	log.Println("Replay: 回放完成")
+	return nil
+}
+
+// StartTrace starts recording every color written to the backend, discarding any earlier recording
+func (c *Controller) StartTrace() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.trace = &traceRecorder{start: c.clock.Now()}
+}
+
+// StopTrace stops recording and returns the trace, nil if no recording was running
+func (c *Controller) StopTrace() *Trace {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.trace == nil {
+		return nil
+	}
+	t := &Trace{Version: TRACE_VERSION, Events: c.trace.events}
+	c.trace = nil
+	return t
+}
+
+// IsTracing returns whether a trace is being recorded
+func (c *Controller) IsTracing() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.trace != nil
+}
+
+// recordTrace appends a written color to the running trace, unless it repeats the previous one.
+// mutex must be held.
+func (c *Controller) recordTrace(color Color) {
+	if c.trace == nil {
+		return
+	}
+	effect := EFFECT_NONE
+	if c.effectActive {
+		effect = c.currentEffectType
+	}
+	if n := len(c.trace.events); n > 0 {
+		last := c.trace.events[n-1]
+		if last.Color == color && last.Effect == effect {
+			return
+		}
+	}
+	c.trace.events = append(c.trace.events, &TraceEvent{
+		// 与文件格式的精度一致，保存再读取后可以精确比较
+		Offset: c.clock.Now().Sub(c.trace.start).Truncate(time.Microsecond),
+		Color:  color,
+		Effect: effect,
+	})
+}
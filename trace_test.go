@@ -0,0 +1,114 @@
+package ledcontroller
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// update rewrites the golden trace files from the current output
+var update = flag.Bool("update", false, "rewrite the golden trace files in testdata")
+
+// checkGoldenTrace compares a recorded trace with a golden file in testdata
+func checkGoldenTrace(t *testing.T, trace *Trace, name string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := trace.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := LoadTraceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := golden.Compare(trace, 0); err != nil {
+		t.Errorf("trace differs from %s: %v", path, err)
+	}
+}
+
+// traceBlink records a red blink, three times 100ms on and 100ms off
+func traceBlink(t *testing.T, c *Controller, clock *FakeClock, timers int) *Trace {
+	t.Helper()
+	c.StartTrace()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.BlinkColor(context.Background(), ColorRed, 3, 100*time.Millisecond, 100*time.Millisecond)
+	}()
+	if !clock.WaitForTimers(timers, time.Second) {
+		t.Fatal("BlinkColor did not wait on the clock")
+	}
+	clock.Advance(600 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return c.StopTrace()
+}
+
+func TestTraceBlinkGolden(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Backend: NewSimBackend(), Clock: clock})
+	checkGoldenTrace(t, traceBlink(t, c, clock, 1), "blink.json")
+}
+
+func TestTraceOffloadedBlinkGolden(t *testing.T) {
+	root := t.TempDir()
+	fakeRGB(t, root, triggerAttrs("255"))
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Discovery: &DiscoveryConfig{Root: root}, Clock: clock})
+	if err := c.SetBrightness(50); err != nil {
+		t.Fatal(err)
+	}
+	// 交给timer触发器时只记录设置触发器时的输出颜色和结束时的关闭
+	checkGoldenTrace(t, traceBlink(t, c, clock, 2), "blink_offload.csv")
+}
+
+func TestTraceRoundTrip(t *testing.T) {
+	trace, err := LoadTraceFile(filepath.Join("testdata", "blink.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []struct {
+		name  string
+		write func(*Trace, *bytes.Buffer) error
+	}{
+		{"json", func(t *Trace, buf *bytes.Buffer) error { return t.WriteJSON(buf) }},
+		{"csv", func(t *Trace, buf *bytes.Buffer) error { return t.WriteCSV(buf) }},
+	} {
+		var buf bytes.Buffer
+		if err := format.write(trace, &buf); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseTrace(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		if err := trace.Compare(parsed, 0); err != nil {
+			t.Errorf("%s round trip: %v", format.name, err)
+		}
+	}
+}
+
+func TestParseTraceInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"null event", `{"version": 1, "events": [null]}`},
+		{"null after event", `{"version": 1, "events": [[0, 1, 2, 3, 0], null]}`},
+		{"short event", `{"version": 1, "events": [[0, 1, 2, 3]]}`},
+		{"color out of range", `{"version": 1, "events": [[0, 256, 0, 0, 0]]}`},
+		{"negative time", "time_us,red,green,blue,effect\n-1,0,0,0,0\n"},
+		{"decreasing time", "200,0,0,0,0\n100,0,0,0,0\n"},
+		{"missing column", "0,0,0,0\n"},
+		{"future version", `{"version": 99, "events": []}`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseTrace([]byte(tt.data)); err == nil {
+			t.Errorf("%s: ParseTrace accepted %q", tt.name, tt.data)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package ledcontroller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kernel LED trigger names
+const (
+	TRIGGER_NONE    = "none"
+	TRIGGER_TIMER   = "timer"
+	TRIGGER_PATTERN = "pattern"
+)
+
+// offloadCheckInterval is how often an offloaded effect checks the LED switch and output settings
+const offloadCheckInterval = 100 * time.Millisecond
+
+// TriggerBackend is implemented by backends that can hand simple blink and
+// breathe patterns to kernel LED triggers, so the CPU can sleep while they run
+type TriggerBackend interface {
+	// HasTrigger reports whether every channel supports the named trigger
+	HasTrigger(name string) bool
+	// StartBlink blinks the color with the timer trigger
+	StartBlink(color Color, onMs, offMs int) error
+	// StartBreathe fades the color in and out with the pattern trigger, repeat -1 means forever
+	StartBreathe(color Color, periodMs, repeat int) error
+	// ClearTrigger gives control of the LED back to brightness writes
+	ClearTrigger() error
+}
+
+// SetHardwareOffload enables or disables running blink and breathe effects on kernel triggers
+func (c *Controller) SetHardwareOffload(enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.hardwareOffload = enabled
+}
+
+// IsHardwareOffloadEnabled returns whether kernel trigger offload is enabled
+func (c *Controller) IsHardwareOffloadEnabled() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.hardwareOffload
+}
+
+// triggerBackendFor returns the current backend if it can run the named trigger
+func (c *Controller) triggerBackendFor(name string) TriggerBackend {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.hardwareOffload || !c.ledEnabled {
+		return nil
+	}
+	tb, ok := c.backend.(TriggerBackend)
+	if !ok || !tb.HasTrigger(name) {
+		return nil
+	}
+	return tb
+}
+
+// traceArmed records the output color a kernel trigger was armed with,
+// the trigger's own brightness changes are not visible to the trace
+func (c *Controller) traceArmed(output Color) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.recordTrace(output)
+}
+
+// runOffloaded arms a kernel trigger and waits until ctx is cancelled or total has elapsed.
+// A total of 0 waits until cancelled. The LED is switched off before returning.
+func (c *Controller) runOffloaded(ctx context.Context, tb TriggerBackend, arm func() error, total time.Duration) error {
+	if err := arm(); err != nil {
+		tb.ClearTrigger()
+		return err
+	}
+	armed := true
+	// 亮度、夜间模式或校准改变后需要按新的输出颜色重新设置触发器
+	c.mutex.Lock()
+	version := c.outputVersion
+	c.mutex.Unlock()
+
+	defer func() {
+		tb.ClearTrigger()
+		c.setColor(ColorOff)
+	}()
+
+	var deadline <-chan time.Time
+	if total > 0 {
+		timer := c.clock.NewTimer(total)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+
+	// 定期检查总开关和输出设置
+	check := c.clock.NewTimer(offloadCheckInterval)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("runOffloaded: 收到停止信号，关闭触发器")
+			return nil
+		case <-deadline:
+			log.Println("runOffloaded: 硬件效果完成")
+			return nil
+		case <-check.C():
+			check.Reset(offloadCheckInterval)
+			c.mutex.Lock()
+			enabled := c.ledEnabled
+			changed := c.outputVersion != version
+			version = c.outputVersion
+			c.mutex.Unlock()
+
+			// 关闭LED总开关时内核会随brightness=0清除触发器，重新开启后需要再次设置
+			if !enabled {
+				armed = false
+			} else if !armed || changed {
+				if err := arm(); err != nil {
+					log.Printf("runOffloaded: 重新设置触发器失败: %v", err)
+					return err
+				}
+				armed = true
+			}
+		}
+	}
+}
+
+// readTriggers parses the trigger attribute of an LED device, e.g. "none [timer] pattern"
+func readTriggers(dir string) map[string]bool {
+	triggers := map[string]bool{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "trigger"))
+	if err != nil {
+		return triggers
+	}
+	for _, name := range strings.Fields(string(data)) {
+		triggers[strings.Trim(name, "[]")] = true
+	}
+	return triggers
+}
+
+// writeAttr writes a sysfs attribute of an LED device
+func writeAttr(dir, name, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644)
+}
+
+// HasTrigger reports whether every channel supports the named trigger
+func (b *SysfsBackend) HasTrigger(name string) bool {
+	for _, ch := range b.channels {
+		if !ch.triggers[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// StartBlink blinks the color with the timer trigger
+func (b *SysfsBackend) StartBlink(color Color, onMs, offMs int) error {
+	for channel, value := range []int{color.Red, color.Green, color.Blue} {
+		ch := &b.channels[channel]
+		if value <= 0 {
+			if err := b.clearChannel(ch); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := writeAttr(ch.dir, "trigger", TRIGGER_TIMER); err != nil {
+			return fmt.Errorf("设置timer触发器失败: %v", err)
+		}
+		if err := writeAttr(ch.dir, "delay_on", strconv.Itoa(onMs)); err != nil {
+			return fmt.Errorf("设置delay_on失败: %v", err)
+		}
+		if err := writeAttr(ch.dir, "delay_off", strconv.Itoa(offMs)); err != nil {
+			return fmt.Errorf("设置delay_off失败: %v", err)
+		}
+		// 闪烁时写入的亮度会作为亮灯亮度，设置触发器后内核已改写brightness，不能跳过
+		ch.brightness.invalidate()
+		if err := b.WriteChannel(channel, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartBreathe fades the color in and out with the pattern trigger, repeat -1 means forever
+func (b *SysfsBackend) StartBreathe(color Color, periodMs, repeat int) error {
+	half := periodMs / 2
+	for channel, value := range []int{color.Red, color.Green, color.Blue} {
+		ch := &b.channels[channel]
+		if value <= 0 {
+			if err := b.clearChannel(ch); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 从0渐变到目标亮度，再渐变回0，循环播放
+		pattern := fmt.Sprintf("0 %d %d %d", half, scaleToDevice(value, ch.maxBrightness), half)
+		if err := writeAttr(ch.dir, "trigger", TRIGGER_PATTERN); err != nil {
+			return fmt.Errorf("设置pattern触发器失败: %v", err)
+		}
+		if err := writeAttr(ch.dir, "pattern", pattern); err != nil {
+			return fmt.Errorf("设置pattern失败: %v", err)
+		}
+		if err := writeAttr(ch.dir, "repeat", strconv.Itoa(repeat)); err != nil {
+			return fmt.Errorf("设置repeat失败: %v", err)
+		}
+		// brightness由pattern触发器控制
+		ch.brightness.invalidate()
+	}
+	return nil
+}
+
+// ClearTrigger gives control of the LED back to brightness writes
+func (b *SysfsBackend) ClearTrigger() error {
+	var firstErr error
+	for i := range b.channels {
+		if err := b.clearChannel(&b.channels[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// clearChannel removes any trigger from a channel and switches it off
+func (b *SysfsBackend) clearChannel(ch *sysfsChannel) error {
+	if len(ch.triggers) > 0 {
+		if err := writeAttr(ch.dir, "trigger", TRIGGER_NONE); err != nil {
+			return fmt.Errorf("清除触发器失败: %v", err)
+		}
+	}
+	ch.brightness.invalidate()
+	return ch.brightness.write("0")
+}
@@ -0,0 +1,151 @@
+package ledcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// triggerAttrs are the attributes of a fake LED supporting the timer and pattern triggers
+func triggerAttrs(maxBrightness string) map[string]string {
+	return map[string]string{
+		"trigger":        "[none] timer pattern",
+		"max_brightness": maxBrightness,
+	}
+}
+
+func TestSysfsBlinkTrigger(t *testing.T) {
+	root := t.TempDir()
+	dirs := fakeRGB(t, root, triggerAttrs("4095"))
+	b, err := DiscoverBackend(&DiscoveryConfig{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := b.(TriggerBackend)
+	if !tb.HasTrigger(TRIGGER_TIMER) || !tb.HasTrigger(TRIGGER_PATTERN) {
+		t.Fatal("HasTrigger did not find the timer and pattern triggers")
+	}
+
+	if err := tb.StartBlink(Color{128, 0, 255}, 200, 300); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		channel    int
+		trigger    string
+		brightness string
+	}{
+		{CHANNEL_RED, TRIGGER_TIMER, "2056"},
+		{CHANNEL_GREEN, TRIGGER_NONE, "0"},
+		{CHANNEL_BLUE, TRIGGER_TIMER, "4095"},
+	}
+	for _, tt := range tests {
+		dir := dirs[tt.channel]
+		if trigger := readTestAttr(t, dir, "trigger"); trigger != tt.trigger {
+			t.Errorf("channel %d trigger = %q, want %q", tt.channel, trigger, tt.trigger)
+		}
+		if brightness := readTestAttr(t, dir, "brightness"); brightness != tt.brightness {
+			t.Errorf("channel %d brightness = %q, want %q", tt.channel, brightness, tt.brightness)
+		}
+		if tt.trigger != TRIGGER_TIMER {
+			continue
+		}
+		if delay := readTestAttr(t, dir, "delay_on"); delay != "200" {
+			t.Errorf("channel %d delay_on = %q, want 200", tt.channel, delay)
+		}
+		if delay := readTestAttr(t, dir, "delay_off"); delay != "300" {
+			t.Errorf("channel %d delay_off = %q, want 300", tt.channel, delay)
+		}
+	}
+
+	if err := tb.ClearTrigger(); err != nil {
+		t.Fatal(err)
+	}
+	for channel, dir := range dirs {
+		if trigger := readTestAttr(t, dir, "trigger"); trigger != TRIGGER_NONE {
+			t.Errorf("channel %d trigger after clear = %q, want none", channel, trigger)
+		}
+		if brightness := readTestAttr(t, dir, "brightness"); brightness != "0" {
+			t.Errorf("channel %d brightness after clear = %q, want 0", channel, brightness)
+		}
+	}
+}
+
+func TestSysfsBreatheTrigger(t *testing.T) {
+	root := t.TempDir()
+	dirs := fakeRGB(t, root, triggerAttrs("4095"))
+	tb := NewSysfsBackend(dirs[0]+"/brightness", dirs[1]+"/brightness", dirs[2]+"/brightness")
+
+	if err := tb.StartBreathe(Color{0, 128, 0}, 1000, -1); err != nil {
+		t.Fatal(err)
+	}
+	green := dirs[CHANNEL_GREEN]
+	if trigger := readTestAttr(t, green, "trigger"); trigger != TRIGGER_PATTERN {
+		t.Errorf("trigger = %q, want pattern", trigger)
+	}
+	if pattern := readTestAttr(t, green, "pattern"); pattern != "0 500 2056 500" {
+		t.Errorf("pattern = %q, want %q", pattern, "0 500 2056 500")
+	}
+	if repeat := readTestAttr(t, green, "repeat"); repeat != "-1" {
+		t.Errorf("repeat = %q, want -1", repeat)
+	}
+	if trigger := readTestAttr(t, dirs[CHANNEL_RED], "trigger"); trigger != TRIGGER_NONE {
+		t.Errorf("unlit red trigger = %q, want none", trigger)
+	}
+}
+
+func TestHasTriggerNeedsEveryChannel(t *testing.T) {
+	root := t.TempDir()
+	fakeLED(t, root, "sc27xx:red", triggerAttrs("255"))
+	fakeLED(t, root, "sc27xx:green", triggerAttrs("255"))
+	fakeLED(t, root, "sc27xx:blue", map[string]string{"trigger": "[none] timer"})
+	b, err := DiscoverBackend(&DiscoveryConfig{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := b.(TriggerBackend)
+	if !tb.HasTrigger(TRIGGER_TIMER) {
+		t.Error("HasTrigger(timer) = false, want true")
+	}
+	if tb.HasTrigger(TRIGGER_PATTERN) {
+		t.Error("HasTrigger(pattern) = true although blue lacks it")
+	}
+}
+
+func TestBlinkColorOffload(t *testing.T) {
+	root := t.TempDir()
+	dirs := fakeRGB(t, root, triggerAttrs("255"))
+	clock := NewFakeClock(time.Time{})
+	c := NewController(&ControllerOptions{Discovery: &DiscoveryConfig{Root: root}, Clock: clock})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.BlinkColor(context.Background(), ColorRed, 3, 100*time.Millisecond, 100*time.Millisecond)
+	}()
+	// 总时长计时器和检查计时器
+	if !clock.WaitForTimers(2, time.Second) {
+		t.Fatal("BlinkColor did not arm its timers")
+	}
+	red := dirs[CHANNEL_RED]
+	if trigger := readTestAttr(t, red, "trigger"); trigger != TRIGGER_TIMER {
+		t.Fatalf("trigger while blinking = %q, want timer", trigger)
+	}
+	if delay := readTestAttr(t, red, "delay_on"); delay != "100" {
+		t.Errorf("delay_on = %q, want 100", delay)
+	}
+
+	clock.Advance(600 * time.Millisecond)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BlinkColor did not return after its total duration")
+	}
+	if trigger := readTestAttr(t, red, "trigger"); trigger != TRIGGER_NONE {
+		t.Errorf("trigger after blinking = %q, want none", trigger)
+	}
+	if brightness := readTestAttr(t, red, "brightness"); brightness != "0" {
+		t.Errorf("brightness after blinking = %q, want 0", brightness)
+	}
+}
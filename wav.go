@@ -0,0 +1,138 @@
+package ledcontroller
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// wavChunk is how much audio FeedWAVFile and AnalyzeWAVFile push at a time
+const wavChunk = 20 * time.Millisecond
+
+// wavAudio is the PCM payload of a WAV file
+type wavAudio struct {
+	sampleRate int
+	channels   int
+	data       []byte
+}
+
+// parseWAV extracts 16 bit PCM from a RIFF/WAVE file
+func parseWAV(data []byte) (*wavAudio, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("不是WAV文件")
+	}
+
+	audio := &wavAudio{}
+	bits := 0
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		body := offset + 8
+		if size < 0 || body+size > len(data) {
+			// 有些录音程序不回填data块的长度，按文件剩余部分处理
+			size = len(data) - body
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("WAV格式块过短")
+			}
+			if format := binary.LittleEndian.Uint16(data[body:]); format != 1 {
+				return nil, fmt.Errorf("仅支持PCM格式的WAV，格式为%d", format)
+			}
+			audio.channels = int(binary.LittleEndian.Uint16(data[body+2:]))
+			audio.sampleRate = int(binary.LittleEndian.Uint32(data[body+4:]))
+			bits = int(binary.LittleEndian.Uint16(data[body+14:]))
+		case "data":
+			audio.data = data[body : body+size]
+		}
+		// 块按偶数字节对齐
+		offset = body + size + size%2
+	}
+
+	if audio.channels == 0 || audio.sampleRate == 0 {
+		return nil, fmt.Errorf("WAV文件缺少格式块")
+	}
+	if bits != 16 {
+		return nil, fmt.Errorf("仅支持16位采样的WAV，采样位数为%d", bits)
+	}
+	if audio.data == nil {
+		return nil, fmt.Errorf("WAV文件缺少数据块")
+	}
+	// 丢弃末尾不完整的帧
+	frameSize := 2 * audio.channels
+	audio.data = audio.data[:len(audio.data)/frameSize*frameSize]
+	return audio, nil
+}
+
+// loadWAV reads and parses a WAV file
+func loadWAV(path string) (*wavAudio, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取WAV文件失败: %v", err)
+	}
+	return parseWAV(data)
+}
+
+// chunks splits the PCM data into blocks of about d each
+func (w *wavAudio) chunks(d time.Duration) [][]byte {
+	frameSize := 2 * w.channels
+	size := int(d*time.Duration(w.sampleRate)/time.Second) * frameSize
+	if size <= 0 {
+		size = frameSize
+	}
+
+	var result [][]byte
+	for offset := 0; offset < len(w.data); offset += size {
+		end := offset + size
+		if end > len(w.data) {
+			end = len(w.data)
+		}
+		result = append(result, w.data[offset:end])
+	}
+	return result
+}
+
+// FeedWAVFile pushes a 16 bit PCM WAV file to the audio-reactive effect in real time,
+// returning when the whole file has been played
+func (c *Controller) FeedWAVFile(path string) error {
+	audio, err := loadWAV(path)
+	if err != nil {
+		return err
+	}
+
+	start := c.clock.Now()
+	var position time.Duration
+	for _, chunk := range audio.chunks(wavChunk) {
+		if err := c.PushPCM16(chunk, audio.sampleRate, audio.channels); err != nil {
+			return err
+		}
+		// 按音频时长计时，推送耗时不会累积成漂移
+		position += time.Duration(len(chunk)/(2*audio.channels)) * time.Second / time.Duration(audio.sampleRate)
+		sleepContext(context.Background(), c.clock, start.Add(position).Sub(c.clock.Now()))
+	}
+	return nil
+}
+
+// AnalyzeWAVFile runs the audio-reactive analysis over a WAV file offline
+// and returns the color after every 20ms of audio
+func AnalyzeWAVFile(path string) ([]Color, error) {
+	audio, err := loadWAV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// 离线分析不经过真实时间，固定的时钟让结果不受运行速度影响
+	analyzer := newAudioAnalyzer(NewFakeClock(time.Time{}))
+	var colors []Color
+	for _, chunk := range audio.chunks(wavChunk) {
+		if err := analyzer.pushPCM16(chunk, audio.sampleRate, audio.channels); err != nil {
+			return nil, err
+		}
+		colors = append(colors, analyzer.color())
+	}
+	return colors, nil
+}
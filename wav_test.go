@@ -0,0 +1,156 @@
+package ledcontroller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testSampleRate is the sample rate of the generated WAV files
+const testSampleRate = 8000
+
+// encodeWAV builds a 16 bit PCM WAV file from interleaved samples
+func encodeWAV(sampleRate, channels, bits int, samples []int16) []byte {
+	var buf bytes.Buffer
+	size := 2 * len(samples)
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+size))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, []uint32{16})
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, uint16(channels)})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(sampleRate), uint32(sampleRate * channels * bits / 8)})
+	binary.Write(&buf, binary.LittleEndian, []uint16{uint16(channels * bits / 8), uint16(bits)})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(size))
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+// writeTestWAV writes a mono 16 bit WAV file and returns its path
+func writeTestWAV(t *testing.T, samples []int16) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.wav")
+	if err := ioutil.WriteFile(path, encodeWAV(testSampleRate, 1, 16, samples), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sine returns d of a sine tone at the given frequency and amplitude in [0, 1]
+func sine(frequency, amplitude float64, d time.Duration) []int16 {
+	samples := make([]int16, int(d*testSampleRate/time.Second))
+	for i := range samples {
+		samples[i] = int16(amplitude * 32767 * math.Sin(2*math.Pi*frequency*float64(i)/testSampleRate))
+	}
+	return samples
+}
+
+// silence returns d of silence
+func silence(d time.Duration) []int16 {
+	return make([]int16, int(d*testSampleRate/time.Second))
+}
+
+// isFlash reports whether a color is a beat flash, all channels raised together
+func isFlash(c Color) bool {
+	return c.Red >= 200 && c.Green >= 200 && c.Blue >= 200
+}
+
+func TestAnalyzeWAVSilence(t *testing.T) {
+	colors, err := AnalyzeWAVFile(writeTestWAV(t, silence(time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(colors) != 50 {
+		t.Fatalf("got %d colors for 1s of audio, want 50", len(colors))
+	}
+	for i, c := range colors {
+		if c != ColorOff {
+			t.Fatalf("color %d of silence is %v, want off", i, c)
+		}
+	}
+}
+
+func TestAnalyzeWAVSteadyTone(t *testing.T) {
+	colors, err := AnalyzeWAVFile(writeTestWAV(t, sine(100, 0.5, 2*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 平稳的音调没有节拍，自动增益把平均电平映射到一半亮度
+	for i, c := range colors {
+		if isFlash(c) {
+			t.Fatalf("steady tone flashed at %v", time.Duration(i)*wavChunk)
+		}
+	}
+	for i, c := range colors[len(colors)/2:] {
+		if c.Red < 100 || c.Red > 160 {
+			t.Fatalf("bass level %d at %v, want about half brightness", c.Red, time.Duration(len(colors)/2+i)*wavChunk)
+		}
+	}
+}
+
+func TestAnalyzeWAVBeats(t *testing.T) {
+	// 120 BPM的低音鼓点：每500ms一个80ms的80Hz脉冲，中间是很轻的底噪
+	var samples []int16
+	const beats = 6
+	samples = append(samples, sine(80, 0.05, 250*time.Millisecond)...)
+	for i := 0; i < beats; i++ {
+		samples = append(samples, sine(80, 0.8, 80*time.Millisecond)...)
+		samples = append(samples, sine(80, 0.05, 420*time.Millisecond)...)
+	}
+
+	colors, err := AnalyzeWAVFile(writeTestWAV(t, samples))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 第i个颜色是分析完第i块音频之后的颜色，记为这块音频结束的时间
+	var onsets []time.Duration
+	for i, c := range colors {
+		if isFlash(c) && (i == 0 || !isFlash(colors[i-1])) {
+			onsets = append(onsets, time.Duration(i+1)*wavChunk)
+		}
+	}
+	if len(onsets) != beats {
+		t.Fatalf("detected %d beats at %v, want %d", len(onsets), onsets, beats)
+	}
+	for i, onset := range onsets {
+		want := 250*time.Millisecond + time.Duration(i)*500*time.Millisecond
+		if onset <= want || onset > want+2*wavChunk {
+			t.Errorf("beat %d detected at %v, want within 40ms after %v", i+1, onset, want)
+		}
+	}
+}
+
+func TestParseWAVStereo(t *testing.T) {
+	samples := []int16{1, 2, 3, 4, 5, 6, 7}
+	audio, err := parseWAV(encodeWAV(44100, 2, 16, samples))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if audio.sampleRate != 44100 || audio.channels != 2 {
+		t.Errorf("parsed %d Hz %d channels, want 44100 Hz 2 channels", audio.sampleRate, audio.channels)
+	}
+	// 末尾不完整的帧被丢弃
+	if len(audio.data) != 12 {
+		t.Errorf("parsed %d bytes of PCM, want 12", len(audio.data))
+	}
+}
+
+func TestParseWAVErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not riff", []byte("this is not a wav file")},
+		{"8 bit", encodeWAV(8000, 1, 8, []int16{0, 0})},
+		{"no data", encodeWAV(8000, 1, 16, nil)[:36]},
+	}
+	for _, tt := range tests {
+		if _, err := parseWAV(tt.data); err == nil {
+			t.Errorf("%s: parseWAV accepted invalid data", tt.name)
+		}
+	}
+}